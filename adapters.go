@@ -0,0 +1,60 @@
+package batchify
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrResultsLengthMismatch is returned when a positional callback does not return exactly one result per input.
+var ErrResultsLengthMismatch = errors.New("results length does not match inputs length")
+
+// positional converts a callback returning results in the same order as inputs into a callback
+// returning results indexed by input.
+func positional[I comparable, O any](do func([]I) ([]O, error)) func([]I) (map[I]O, error) {
+	return func(inputs []I) (map[I]O, error) {
+		outputs, err := do(inputs)
+
+		if len(outputs) != len(inputs) {
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("%w: got %d results for %d inputs", ErrResultsLengthMismatch, len(outputs), len(inputs))
+		}
+
+		results := make(map[I]O, len(inputs))
+		for i := range inputs {
+			results[inputs[i]] = outputs[i]
+		}
+
+		return results, err
+	}
+}
+
+// Group converts a callback returning a flat list of rows into a callback returning the rows of each input,
+// for one-to-many loads. `owner` returns the input a row belongs to. Inputs without rows get an empty slice,
+// and rows that do not belong to any input are dropped.
+//
+//	batch := batchify.NewBatch(10, batchify.Group(fetchComments, func(c Comment) int { return c.PostID }))
+func Group[I comparable, O any](do func([]I) ([]O, error), owner func(O) I) func([]I) (map[I][]O, error) {
+	assertValue(do != nil, "callback must not be nil")
+	assertValue(owner != nil, "owner function must not be nil")
+
+	return func(inputs []I) (map[I][]O, error) {
+		rows, err := do(inputs)
+
+		results := make(map[I][]O, len(inputs))
+		for _, input := range inputs {
+			results[input] = []O{}
+		}
+
+		for _, row := range rows {
+			key := owner(row)
+			if group, ok := results[key]; ok {
+				results[key] = append(group, row)
+			}
+		}
+
+		return results, err
+	}
+}
@@ -0,0 +1,128 @@
+package batchify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPositional(t *testing.T) {
+	is := assert.New(t)
+
+	do := positional(func(inputs []int) ([]string, error) {
+		outputs := make([]string, 0, len(inputs))
+		for _, input := range inputs {
+			if input >= 0 {
+				outputs = append(outputs, string(rune('a'+input)))
+			}
+		}
+		return outputs, nil
+	})
+
+	results, err := do([]int{2, 0, 1})
+	is.Nil(err)
+	is.Equal(map[int]string{0: "a", 1: "b", 2: "c"}, results)
+
+	results, err = do([]int{})
+	is.Nil(err)
+	is.Empty(results)
+
+	results, err = do([]int{0, -1})
+	is.ErrorIs(err, ErrResultsLengthMismatch)
+	is.EqualError(err, "results length does not match inputs length: got 1 results for 2 inputs")
+	is.Nil(results)
+}
+
+func TestPositional_error(t *testing.T) {
+	is := assert.New(t)
+
+	do := positional(func(inputs []int) ([]int, error) {
+		return inputs, assert.AnError
+	})
+	results, err := do([]int{1, 2})
+	is.ErrorIs(err, assert.AnError)
+	is.Equal(map[int]int{1: 1, 2: 2}, results)
+
+	do = positional(func(inputs []int) ([]int, error) {
+		return nil, assert.AnError
+	})
+	results, err = do([]int{1, 2})
+	is.ErrorIs(err, assert.AnError)
+	is.NotErrorIs(err, ErrResultsLengthMismatch)
+	is.Nil(results)
+}
+
+func TestGroup(t *testing.T) {
+	is := assert.New(t)
+
+	type comment struct {
+		postID int
+		body   string
+	}
+
+	do := Group(
+		func(postIDs []int) ([]comment, error) {
+			return []comment{
+				{postID: 1, body: "a"},
+				{postID: 3, body: "b"},
+				{postID: 1, body: "c"},
+				{postID: 42, body: "d"},
+			}, nil
+		},
+		func(c comment) int { return c.postID },
+	)
+
+	results, err := do([]int{1, 2, 3})
+	is.Nil(err)
+	is.Equal(map[int][]comment{
+		1: {{postID: 1, body: "a"}, {postID: 1, body: "c"}},
+		2: {},
+		3: {{postID: 3, body: "b"}},
+	}, results)
+	is.NotNil(results[2])
+
+	is.Panics(func() {
+		_ = Group[int, comment](nil, func(c comment) int { return c.postID })
+	})
+	is.Panics(func() {
+		_ = Group[int, comment](func(postIDs []int) ([]comment, error) { return nil, nil }, nil)
+	})
+}
+
+func TestGroup_error(t *testing.T) {
+	is := assert.New(t)
+
+	do := Group(
+		func(ids []int) ([]int, error) {
+			return nil, assert.AnError
+		},
+		func(row int) int { return row },
+	)
+
+	results, err := do([]int{1, 2})
+	is.ErrorIs(err, assert.AnError)
+	is.Equal(map[int][]int{1: {}, 2: {}}, results)
+}
+
+func TestGroup_batch(t *testing.T) {
+	is := assert.New(t)
+
+	batch := NewBatch(2, Group(
+		func(ids []int) ([]int, error) {
+			return []int{ids[0], ids[0], ids[1]}, nil
+		},
+		func(row int) int { return row },
+	))
+	defer batch.Stop()
+
+	go func() {
+		result, err := batch.Do(1)
+		is.Nil(err)
+		is.Equal([]int{1, 1}, result)
+	}()
+	time.Sleep(2 * time.Millisecond)
+	result, err := batch.Do(2)
+	is.Nil(err)
+	is.Equal([]int{2}, result)
+}
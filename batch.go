@@ -1,129 +1,788 @@
 package batchify
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/samber/lo"
+	"github.com/samber/go-batchify/pkg/hasher"
 )
 
+// batchOptions holds the read-only settings of a batchImpl.
+type batchOptions[I any, K comparable, O any] struct {
+	bufferSize int
+	ttl        time.Duration
+	key        func(I) K
+	do         func([]I) (map[K]O, error)
+
+	// optional: replaces `do`, with access to BatchInfo
+	doWithContext func(ctx context.Context, inputs []I) (map[K]O, error)
+
+	// optional: name of the batcher, used by pprof labels and runtime/trace
+	name string
+
+	// index of the shard served by this batch, or 0
+	shard int
+
+	// optional: sorts inputs before calling `do`
+	less func(a, b I) bool
+
+	// optional: max buffer duration when the buffer holds low-priority inputs only
+	lowPriorityTTL time.Duration
+
+	// optional: number of stripes of the deduplication index. Defaults to runtime.GOMAXPROCS(0), at most bufferSize.
+	stripes int
+
+	// optional: gives each stripe its own part of the buffer and size counter. See reserve().
+	partitioned bool
+
+	// optional: recycles buffers once every caller received its result
+	pooling bool
+
+	// optional: logs dispatches and callback outcomes
+	logger        *slog.Logger
+	slowThreshold time.Duration
+
+	// optional: defaults to RealClock
+	clock Clock
+
+	// optional: defaults to DefaultExecutor
+	executor Executor
+
+	// optional: dispatches the buffer right away when no callback is in flight
+	idleDispatch bool
+
+	// optional: max number of waiting callers while paused. 0 means unlimited.
+	pauseLimit int
+}
+
 func newBatch[I comparable, O any](
 	bufferSize int,
 	ttl time.Duration,
 	do func([]I) (map[I]O, error),
-) *batchImpl[I, O] {
-	b := &batchImpl[I, O]{
-		timer: nil,
-		mu:    sync.RWMutex{},
-
-		// read-only
+) *batchImpl[I, I, O] {
+	return newBatchWithOptions(batchOptions[I, I, O]{
 		bufferSize: bufferSize,
 		ttl:        ttl,
+		key:        identity[I],
+		do:         do,
+	})
+}
+
+func newBatchWithOptions[I any, K comparable, O any](opts batchOptions[I, K, O]) *batchImpl[I, K, O] {
+	if opts.stripes < 1 {
+		opts.stripes = runtime.GOMAXPROCS(0)
+	}
+	if opts.stripes > opts.bufferSize {
+		opts.stripes = opts.bufferSize
+	}
+
+	if opts.clock == nil {
+		opts.clock = RealClock{}
+	}
+
+	if opts.executor == nil {
+		opts.executor = DefaultExecutor{}
+	}
+
+	do := opts.doWithContext
+	if do == nil {
+		do = func(_ context.Context, inputs []I) (map[K]O, error) {
+			return opts.do(inputs)
+		}
+	}
+
+	b := &batchImpl[I, K, O]{
+		counters: counters{
+			lanes: make([]lane, opts.stripes),
+		},
+		index: newIndex[K](opts.bufferSize, opts.stripes),
+
+		timer:         nil,
+		deadlineTimer: nil,
+		mu:            sync.Mutex{},
+		stopped:       0,
+		dispatched:    0,
+		rotations:     0,
+		sealed:        nil,
+
+		pauseMu: sync.Mutex{},
+		paused:  0,
+		held:    nil,
+
+		// read-only
+		bufferSize: opts.bufferSize,
+		ttl:        opts.ttl,
+		key:        opts.key,
 		do:         do,
+		less:       opts.less,
+		shard:      opts.shard,
+		name:       opts.name,
 
-		buffer: newBuffer[I, O](bufferSize),
+		lowPriorityTTL: opts.lowPriorityTTL,
+		partitioned:    opts.partitioned,
+		pooling:        opts.pooling,
+		logger:         opts.logger,
+		slowThreshold:  opts.slowThreshold,
+		clock:          opts.clock,
+		executor:       opts.executor,
+		idleDispatch:   opts.idleDispatch,
+		pauseLimit:     opts.pauseLimit,
+
+		buffer: atomic.Pointer[buffer[I, K, O]]{},
+		pool:   sync.Pool{},
 	}
 
+	b.buffer.Store(b.newBuffer())
+
+	// the timer callback must not observe a half-initialized timer
+	b.mu.Lock()
 	b.resetTimer()
+	b.mu.Unlock()
+
 	return b
 }
 
-var _ Batch[string, int] = (*batchImpl[string, int])(nil)
+var _ Batch[string, int] = (*batchImpl[string, string, int])(nil)
+
+type batchImpl[I any, K comparable, O any] struct {
+	counters counters    // first field, for 64-bit alignment
+	index    []stripe[K] // deduplication index of the current buffer, striped by key. See insert().
 
-type batchImpl[I comparable, O any] struct {
-	timer *time.Timer
-	mu    sync.RWMutex
+	// mu protects the timers and serializes buffer swaps. Do() never takes it.
+	timer         Timer
+	deadlineTimer Timer // see trackDeadline
+	mu            sync.Mutex
+	stopped       int32 // atomic
+	dispatched    int32 // atomic: number of buffers rotated and not completed yet. Incremented under mutex lock.
+	rotations     uint64
+	sealed        []*buffer[I, K, O] // rotated buffers whose callback has not returned yet, in order
+
+	// pauseMu protects the buffers held while paused. See Pause().
+	pauseMu sync.Mutex
+	paused  int32 // atomic
+	held    []*buffer[I, K, O]
 
 	bufferSize int
 	ttl        time.Duration
-	do         func([]I) (map[I]O, error)
+	key        func(I) K
+	do         func(ctx context.Context, inputs []I) (map[K]O, error)
+	less       func(a, b I) bool
+	shard      int
+	name       string
+
+	lowPriorityTTL time.Duration
+	partitioned    bool
+	pooling        bool
+	logger         *slog.Logger
+	slowThreshold  time.Duration
+	clock          Clock
+	executor       Executor
+	idleDispatch   bool
+	pauseLimit     int
 
-	buffer *buffer[I, O]
+	buffer atomic.Pointer[buffer[I, K, O]]
+	pool   sync.Pool // *buffer[I, K, O]
 }
 
-func (b *batchImpl[I, O]) Do(input I) (output O, err error) {
-	b.mu.Lock()
+// stripe is padded to a cache line, to prevent false sharing between cores. Its mutex protects
+// the keys, and delays the rotation of the buffer being written. See batchImpl.rotate().
+type stripe[K comparable] struct {
+	mu   sync.Mutex
+	seq  uint64         // rank of the buffer indexed by keys
+	keys map[K]struct{} // reused from one buffer to the next
 
-	currentBuffer := b.buffer
-	if _, ok := currentBuffer.values[input]; !ok {
-		currentBuffer.values[input] = lo.Empty[O]()
-		currentBuffer.size++
+	// part of the buffer owned by the stripe, when partitioned. See batchImpl.reserve().
+	start int
+	quota int
+	size  int32 // atomic: reset by batchImpl.rotate(), under every stripe lock
+	_     [20]byte
+}
+
+// newIndex splits a buffer of `bufferSize` inputs evenly between `stripes` stripes.
+func newIndex[K comparable](bufferSize int, stripes int) []stripe[K] {
+	index := make([]stripe[K], stripes)
+
+	start := 0
+	for i := range index {
+		index[i].start = start
+		index[i].quota = bufferSize / stripes
+		if i < bufferSize%stripes {
+			index[i].quota++
+		}
+		start += index[i].quota
 	}
 
-	bufferIsFull := currentBuffer.size == b.bufferSize
+	return index
+}
+
+func (b *batchImpl[I, K, O]) Do(input I) (output O, err error) {
+	return b.DoWithPriority(input, PriorityNormal)
+}
 
-	if bufferIsFull {
-		b.buffer = newBuffer[I, O](b.bufferSize)
-		b.resetTimer()
+func (b *batchImpl[I, K, O]) DoWithPriority(input I, priority Priority) (output O, err error) {
+	return b.submit(context.Background(), input, priority)
+}
+
+// DoWithContext stops waiting when `ctx` is done. When `ctx` has a deadline, the buffer is flushed
+// early enough for the callback to complete before it, based on the duration of previous callbacks.
+func (b *batchImpl[I, K, O]) DoWithContext(ctx context.Context, input I) (output O, err error) {
+	return b.submit(ctx, input, PriorityNormal)
+}
+
+func (b *batchImpl[I, K, O]) submit(ctx context.Context, input I, priority Priority) (output O, err error) {
+	if err := b.admit(); err != nil {
+		return output, err
 	}
+	defer b.leave()
+
+	key := b.key(input)
+	currentBuffer, full := b.insert(input, key)
+
+	// also when the callback panics on this goroutine, eg: with InlineExecutor
+	defer b.recycle(currentBuffer)
+
+	b.schedule(currentBuffer, priority, full)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		b.trackDeadline(currentBuffer, deadline)
+	}
+
+	if done := ctx.Done(); done != nil {
+		select {
+		case <-currentBuffer.done:
+		case <-done:
+			// the input is still dispatched, for the other waiters
+			return output, ctx.Err()
+		}
+	} else {
+		<-currentBuffer.done
+	}
+
+	// outputs[key] might be empty
+	return currentBuffer.values[key], currentBuffer.err
+}
+
+// insert adds an input to the current buffer, and returns true when the input filled the buffer.
+// The returned buffer is retained, and must be recycled once the result has been read.
+//
+// It takes no batch-wide lock. Keys are striped across runtime.GOMAXPROCS(0) stripes, each with its
+// own mutex, index and counters: concurrent calls only contend on keys of the same stripe. New keys
+// also reserve their position in the buffer, with a single atomic operation. See reserve().
+func (b *batchImpl[I, K, O]) insert(input I, key K) (*buffer[I, K, O], bool) {
+	stripeIdx := 0
+	if len(b.index) > 1 {
+		stripeIdx = int(hasher.Comparable(key) % uint64(len(b.index)))
+	}
+
+	stripe := &b.index[stripeIdx]
+	lane := &b.counters.lanes[stripeIdx]
+	atomic.AddUint64(&lane.inputs, 1)
+
+	for {
+		stripe.mu.Lock()
+
+		// loaded under the stripe lock: the buffer cannot be dispatched, and recycled, until unlocked
+		currentBuffer := b.current()
+		if stripe.seq != currentBuffer.seq {
+			clear(stripe.keys)
+			stripe.seq = currentBuffer.seq
+		}
+
+		full := false
+		if _, ok := stripe.keys[key]; ok {
+			atomic.AddUint64(&lane.dedupHits, 1)
+		} else {
+			position, filled, ok := b.reserve(currentBuffer, stripeIdx)
+			if !ok {
+				// the buffer is full: dispatch it and retry with the next one
+				stripe.mu.Unlock()
+				b.swap(currentBuffer, FlushReasonSize)
+				continue
+			}
+
+			if stripe.keys == nil {
+				stripe.keys = map[K]struct{}{}
+			}
+			stripe.keys[key] = struct{}{}
+			currentBuffer.inputs[position] = input
+			full = filled
+		}
+
+		b.retain(currentBuffer)
+
+		stripe.mu.Unlock()
+
+		return currentBuffer, full
+	}
+}
+
+// reserve returns the position of a new input in the current buffer, and true when the input fills the
+// buffer. It returns false when the buffer is full already. It must be called under the lock of the stripe
+// of the input.
+//
+// When partitioned, each stripe reserves positions in its own part of the buffer, with its own counter,
+// so that new keys of different stripes do not write the same cache line. A stripe whose part is full
+// borrows positions from the next ones: the buffer is only full once every part is. The parts are merged
+// when the buffer is rotated.
+func (b *batchImpl[I, K, O]) reserve(currentBuffer *buffer[I, K, O], stripeIdx int) (position int, full bool, ok bool) {
+	if !b.partitioned {
+		position, ok = currentBuffer.reserve()
+		return position, ok && position == len(currentBuffer.inputs)-1, ok
+	}
+
+	for i := 0; i < len(b.index); i++ {
+		part := &b.index[(stripeIdx+i)%len(b.index)]
+		for {
+			size := atomic.LoadInt32(&part.size)
+			if int(size) >= part.quota {
+				break
+			}
+
+			if atomic.CompareAndSwapInt32(&part.size, size, size+1) {
+				// the parts only fill up until the rotation: the input filling the last part sees every part full
+				full = int(size) == part.quota-1 && b.pending() == b.bufferSize
+				return part.start + int(size), full, true
+			}
+		}
+	}
+
+	return 0, false, false
+}
+
+// pending returns the number of inputs of the current buffer.
+func (b *batchImpl[I, K, O]) pending() int {
+	if !b.partitioned {
+		return b.current().len()
+	}
+
+	size := 0
+	for i := range b.index {
+		size += int(atomic.LoadInt32(&b.index[i].size))
+	}
+	return size
+}
+
+// schedule dispatches the buffer of a new input when needed, or restores the regular timer.
+func (b *batchImpl[I, K, O]) schedule(currentBuffer *buffer[I, K, O], priority Priority, full bool) {
+	// the timer is only extended when the low-priority window is longer than the regular one
+	if priority != PriorityLow && atomic.LoadInt32(&currentBuffer.prioritized) == 0 && atomic.CompareAndSwapInt32(&currentBuffer.prioritized, 0, 1) && b.lowPriorityTTL > b.ttl {
+		b.restoreTimer(currentBuffer)
+	}
+
+	// high-priority inputs flush the buffer right away, as well as inputs received after Stop()
+	switch {
+	case atomic.LoadInt32(&b.stopped) == 1:
+		b.swap(currentBuffer, FlushReasonStop)
+	case full:
+		b.swap(currentBuffer, FlushReasonSize)
+	case priority == PriorityHigh:
+		b.swap(currentBuffer, FlushReasonPriority)
+	case b.idleDispatch && atomic.LoadInt32(&b.dispatched) == 0:
+		b.dispatchIfIdle()
+	}
+}
+
+func (b *batchImpl[I, K, O]) current() *buffer[I, K, O] {
+	return b.buffer.Load()
+}
+
+// rotate replaces the current buffer by an empty one, and waits for its writers. It must be called under mutex lock.
+func (b *batchImpl[I, K, O]) rotate(reason FlushReason) *buffer[I, K, O] {
+	currentBuffer := b.current()
+	currentBuffer.reason = reason
+	atomic.AddInt32(&b.dispatched, 1)
+	b.sealed = append(b.sealed, currentBuffer)
+
+	next := b.newBuffer()
+	b.rotations++
+	next.seq = b.rotations
+
+	// writers holding a stripe might still be writing to the previous buffer. The next ones load the new buffer.
+	for i := range b.index {
+		b.index[i].mu.Lock()
+	}
+
+	b.buffer.Store(next)
+	if b.partitioned {
+		b.merge(currentBuffer)
+	}
+
+	for i := range b.index {
+		b.index[i].mu.Unlock()
+	}
+
+	b.resetTimer()
+
+	return currentBuffer
+}
+
+// merge moves the parts of a partitioned buffer to the front of its inputs, in stripe order, and resets
+// the parts for the next buffer. It must be called under every stripe lock.
+func (b *batchImpl[I, K, O]) merge(currentBuffer *buffer[I, K, O]) {
+	size := 0
+	for i := range b.index {
+		part := &b.index[i]
+		partSize := int(atomic.LoadInt32(&part.size))
+		copy(currentBuffer.inputs[size:], currentBuffer.inputs[part.start:part.start+partSize])
+		size += partSize
+		atomic.StoreInt32(&part.size, 0)
+	}
+
+	// release the references left behind by the moved inputs
+	clear(currentBuffer.inputs[size:])
+	atomic.StoreInt32(&currentBuffer.size, int32(size))
+}
+
+// swap dispatches `currentBuffer`, unless it has already been dispatched.
+func (b *batchImpl[I, K, O]) swap(currentBuffer *buffer[I, K, O], reason FlushReason) {
+	b.mu.Lock()
+
+	if b.current() != currentBuffer {
+		b.mu.Unlock()
+		return
+	}
+
+	b.rotate(reason)
 
 	b.mu.Unlock()
 
-	if bufferIsFull {
-		b.execCallback(currentBuffer)
+	b.execCallback(currentBuffer)
+}
+
+// dispatchIfIdle dispatches the current buffer, unless it is empty or another buffer is in flight.
+func (b *batchImpl[I, K, O]) dispatchIfIdle() {
+	b.mu.Lock()
+
+	if atomic.LoadInt32(&b.dispatched) > 0 || b.pending() == 0 {
+		b.mu.Unlock()
+		return
 	}
 
-	// do not call wg.Wait() if `input` is the last element of the buffer
-	currentBuffer.wg.Wait()
+	currentBuffer := b.rotate(FlushReasonIdle)
+
+	b.mu.Unlock()
 
-	// outputs[input] might be empty
-	return currentBuffer.values[input], currentBuffer.err
+	b.execCallback(currentBuffer)
 }
 
-func (b *batchImpl[I, O]) Stop() {
+// Stop flushes the pending inputs and waits for the callback. Inputs received after Stop() are dispatched right away.
+func (b *batchImpl[I, K, O]) Stop() {
+	b.mu.Lock()
+	atomic.StoreInt32(&b.stopped, 1)
 	if b.timer != nil {
 		b.timer.Stop()
 	}
-
-	b.mu.Lock()
 	b.timer = nil
-	currentBuffer := b.buffer
-	b.buffer = newBuffer[I, O](b.bufferSize)
+	if b.deadlineTimer != nil {
+		b.deadlineTimer.Stop()
+	}
+	currentBuffer := b.rotate(FlushReasonStop)
 	b.mu.Unlock()
 
+	// the buffers held by Pause() are dispatched before the last one
+	b.Resume()
+
+	b.retain(currentBuffer)
 	b.execCallback(currentBuffer)
-	currentBuffer.wg.Wait()
+	<-currentBuffer.done
+	b.recycle(currentBuffer)
+}
+
+func (b *batchImpl[I, K, O]) Flush() {
+	b.flush(FlushReasonManual)
 }
 
-func (b *batchImpl[I, O]) Flush() {
+// FlushAndWait flushes the pending inputs, and waits for the callbacks of every buffer dispatched so far,
+// including the buffers held by Pause(). It returns the errors of these callbacks, joined, or the context
+// error when `ctx` is done first.
+func (b *batchImpl[I, K, O]) FlushAndWait(ctx context.Context) error {
 	b.mu.Lock()
 
-	currentBuffer := b.buffer
-	if currentBuffer.size == 0 {
+	var flushed *buffer[I, K, O]
+	if b.pending() > 0 {
+		flushed = b.rotate(FlushReasonManual)
+	}
+
+	// held until the errors are read: the buffers might be recycled once the callbacks return
+	buffers := append([]*buffer[I, K, O]{}, b.sealed...)
+	for _, buffer := range buffers {
+		b.retain(buffer)
+	}
+
+	b.mu.Unlock()
+
+	defer func() {
+		for _, buffer := range buffers {
+			b.recycle(buffer)
+		}
+	}()
+
+	if flushed != nil {
+		b.execCallback(flushed)
+	}
+
+	errs := make([]error, 0, len(buffers))
+	for _, buffer := range buffers {
+		select {
+		case <-buffer.done:
+			errs = append(errs, buffer.err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Stats returns a snapshot of the batch activity.
+func (b *batchImpl[I, K, O]) Stats() Stats {
+	return b.counters.snapshot(b.pending())
+}
+
+// Settings returns the configuration of the batch.
+func (b *batchImpl[I, K, O]) Settings() Settings {
+	return Settings{
+		Name:           b.name,
+		BufferSize:     b.bufferSize,
+		TTL:            b.ttl,
+		LowPriorityTTL: b.lowPriorityTTL,
+		Shards:         nil,
+	}
+}
+
+func (b *batchImpl[I, K, O]) flush(reason FlushReason) {
+	b.mu.Lock()
+
+	if b.pending() == 0 {
 		b.resetTimer()
 		b.mu.Unlock()
 		return
 	}
 
-	b.buffer = newBuffer[I, O](b.bufferSize)
-	b.resetTimer()
+	currentBuffer := b.rotate(reason)
 
 	b.mu.Unlock()
 
 	b.execCallback(currentBuffer)
 }
 
+// onTimer flushes the buffer, unless it holds low-priority inputs only and
+// the low-priority window is not over yet.
+func (b *batchImpl[I, K, O]) onTimer() {
+	b.mu.Lock()
+
+	currentBuffer := b.current()
+	if b.pending() > 0 && atomic.LoadInt32(&currentBuffer.prioritized) == 0 && !currentBuffer.extended && b.lowPriorityTTL > b.ttl {
+		currentBuffer.extended = true
+		if b.timer != nil {
+			b.timer.Reset(b.lowPriorityTTL - b.ttl)
+		}
+		b.mu.Unlock()
+		return
+	}
+
+	b.mu.Unlock()
+
+	b.flush(FlushReasonTimer)
+}
+
+// restoreTimer restores the regular window, when the timer has been extended for low-priority inputs.
+func (b *batchImpl[I, K, O]) restoreTimer(currentBuffer *buffer[I, K, O]) {
+	b.mu.Lock()
+	if b.current() == currentBuffer && currentBuffer.extended {
+		b.resetTimer()
+	}
+	b.mu.Unlock()
+}
+
 // execCallback must be called out of mutex lock to prevent slowdown due to long-running callback.
-func (b *batchImpl[I, O]) execCallback(buffer *buffer[I, O]) {
-	go buffer.once.Do(func() {
-		if buffer.size > 0 {
-			buffer.values, buffer.err = b.do(lo.Keys(buffer.values))
+func (b *batchImpl[I, K, O]) execCallback(buffer *buffer[I, K, O]) {
+	if b.hold(buffer) {
+		return
+	}
+
+	b.execute(buffer)
+}
+
+// execute runs the callback of a sealed buffer, with the executor.
+func (b *batchImpl[I, K, O]) execute(buffer *buffer[I, K, O]) {
+	b.executor.Execute(func() {
+		defer func() {
+			b.complete(buffer)
+
+			// out of once.Do(), which marks completion after the callback returns
+			b.recycle(buffer)
+
+			// inputs received while the callback was running are dispatched now, out of the executor:
+			// a bounded executor would deadlock, if every worker was waiting for a free worker
+			if atomic.AddInt32(&b.dispatched, -1) == 0 && b.idleDispatch && b.pending() > 0 {
+				go b.dispatchIfIdle()
+			}
+		}()
+
+		buffer.once.Do(func() {
+			b.run(buffer)
+		})
+	})
+}
+
+// complete forgets a buffer whose callback returned. See FlushAndWait.
+func (b *batchImpl[I, K, O]) complete(buffer *buffer[I, K, O]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, sealed := range b.sealed {
+		if sealed == buffer {
+			b.sealed = append(b.sealed[:i], b.sealed[i+1:]...)
+			return
 		}
+	}
+}
+
+// run calls the callback and releases the waiters.
+func (b *batchImpl[I, K, O]) run(buffer *buffer[I, K, O]) {
+	defer close(buffer.done)
 
-		buffer.wg.Done()
+	size := buffer.len()
+	if size == 0 {
+		return
+	}
+
+	ctx := b.begin(buffer, size)
+	defer b.end(buffer, ctx)
+
+	b.invoke(ctx, buffer, size)
+}
+
+// invoke calls the callback with the inputs of the buffer. It is split from run(), so that end() runs
+// on a shallow stack: the callback goroutine starts with a small one, and growing it is costly.
+func (b *batchImpl[I, K, O]) invoke(ctx *infoContext, buffer *buffer[I, K, O], size int) {
+	inputs := b.sortInputs(buffer.inputs[:size])
+
+	if b.name == "" {
+		buffer.values, buffer.err = b.call(ctx, inputs)
+		return
+	}
+
+	b.profile(ctx, ctx.info, func(ctx context.Context) {
+		buffer.values, buffer.err = b.call(ctx, inputs)
 	})
 }
 
-func (b *batchImpl[I, O]) resetTimer() {
-	if b.ttl == 0 {
+// begin counts a dispatch, and returns the context of its callback. The context is part of the buffer:
+// like the inputs, callbacks must not retain it when buffers are pooled.
+func (b *batchImpl[I, K, O]) begin(buffer *buffer[I, K, O], size int) *infoContext {
+	start := b.clock.Now()
+	atomic.AddUint64(&b.counters.flushes[buffer.reason.index()], 1)
+	atomic.StoreInt64(&b.counters.lastFlush, start.UnixNano())
+	atomic.AddInt64(&b.counters.inFlight, 1)
+
+	buffer.ctx = infoContext{
+		Context: context.Background(),
+		info: BatchInfo{
+			Name:   b.name,
+			Shard:  b.shard,
+			Reason: buffer.reason,
+			Size:   size,
+			Time:   start,
+		},
+	}
+
+	return &buffer.ctx
+}
+
+// end counts the outcome of a callback. A panic of the callback is returned to the waiters
+// as ErrCallbackPanic, then raised again once the buffer is completed.
+func (b *batchImpl[I, K, O]) end(buffer *buffer[I, K, O], ctx *infoContext) {
+	r := recover()
+	if r != nil {
+		buffer.values, buffer.err = nil, panicError(r)
+	}
+
+	duration := since(b.clock, ctx.info.Time)
+
+	atomic.AddInt64(&b.counters.inFlight, -1)
+	if buffer.err != nil {
+		atomic.AddUint64(&b.counters.errors, 1)
+	}
+
+	b.counters.record(FlushEvent{
+		Shard:    b.shard,
+		Reason:   buffer.reason,
+		Size:     ctx.info.Size,
+		Time:     ctx.info.Time,
+		Duration: duration,
+		Err:      buffer.err,
+	})
+
+	if r != nil {
+		panic(r)
+	}
+}
+
+func panicError(r any) error {
+	return fmt.Errorf("%w: %v", ErrCallbackPanic, r)
+}
+
+func (b *batchImpl[I, K, O]) newBuffer() *buffer[I, K, O] {
+	if b.pooling {
+		if buf, ok := b.pool.Get().(*buffer[I, K, O]); ok {
+			return buf
+		}
+	}
+
+	return newBuffer[I, K, O](b.bufferSize)
+}
+
+// retain registers a reader of the results of the buffer. References are only counted with pooling:
+// otherwise, unused buffers are left to the garbage collector.
+func (b *batchImpl[I, K, O]) retain(buffer *buffer[I, K, O]) {
+	if b.pooling {
+		buffer.retain()
+	}
+}
+
+// recycle releases a reference to the buffer. Once unused, the buffer is put back in the pool.
+func (b *batchImpl[I, K, O]) recycle(buffer *buffer[I, K, O]) {
+	if b.pooling && buffer.drop() {
+		buffer.reset()
+		b.pool.Put(buffer)
+	}
+}
+
+// resetTimer must be called under mutex lock.
+func (b *batchImpl[I, K, O]) resetTimer() {
+	if b.ttl == 0 || atomic.LoadInt32(&b.stopped) == 1 {
 		return
 	}
 
 	if b.timer != nil {
 		b.timer.Reset(b.ttl)
 	} else {
-		b.timer = time.AfterFunc(b.ttl, func() {
-			b.Flush()
+		b.timer = b.clock.AfterFunc(b.ttl, func() {
+			b.onTimer()
 		})
 	}
 }
+
+// sortInputs returns inputs in arrival order, or sorted when a comparator is provided.
+func (b *batchImpl[I, K, O]) sortInputs(inputs []I) []I {
+	if b.less != nil {
+		sort.SliceStable(inputs, func(i, j int) bool {
+			return b.less(inputs[i], inputs[j])
+		})
+	}
+
+	return inputs
+}
+
+func identity[T any](v T) T {
+	return v
+}
@@ -1,9 +1,16 @@
 package batchify
 
 import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/samber/go-batchify/pkg/hasher"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,7 +23,7 @@ func TestNewBatch(t *testing.T) {
 	is.Equal(42, b.bufferSize)
 	is.EqualValues(0, b.ttl)
 	is.NotNil(b.do)
-	is.NotNil(b.buffer)
+	is.NotNil(b.current())
 }
 
 func TestBatchImpl_Stop_noTimer(t *testing.T) {
@@ -24,19 +31,15 @@ func TestBatchImpl_Stop_noTimer(t *testing.T) {
 
 	b := newBatch(42, 0, mockDoOk)
 	is.Nil(b.timer)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 
-	b.buffer.values["key"] = "42"
-	b.buffer.size++
+	b.enqueue("key", "key", PriorityNormal)
 	is.Nil(b.timer)
-	is.Len(b.buffer.values, 1)
-	is.Equal(1, b.buffer.size)
+	is.Equal(1, b.current().len())
 
 	b.Stop()
 	is.Nil(b.timer)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 }
 
 func TestBatchImpl_Stop_withTimer(t *testing.T) {
@@ -44,19 +47,15 @@ func TestBatchImpl_Stop_withTimer(t *testing.T) {
 
 	b := newBatch(42, 5*time.Millisecond, mockDoOk)
 	is.NotNil(b.timer)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 
-	b.buffer.values["key"] = "42"
-	b.buffer.size++
+	b.enqueue("key", "key", PriorityNormal)
 	is.NotNil(b.timer)
-	is.Len(b.buffer.values, 1)
-	is.Equal(1, b.buffer.size)
+	is.Equal(1, b.current().len())
 
 	b.Stop()
 	is.Nil(b.timer)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 }
 
 func TestBatchImpl_Flush_noTimer(t *testing.T) {
@@ -64,19 +63,15 @@ func TestBatchImpl_Flush_noTimer(t *testing.T) {
 
 	b := newBatch(42, 0, mockDoOk)
 	is.Nil(b.timer)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 
-	b.buffer.values["key"] = "42"
-	b.buffer.size++
+	b.enqueue("key", "key", PriorityNormal)
 	is.Nil(b.timer)
-	is.Len(b.buffer.values, 1)
-	is.Equal(1, b.buffer.size)
+	is.Equal(1, b.current().len())
 
 	b.Flush()
 	is.Nil(b.timer)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 }
 
 func TestBatchImpl_Flush_withTimer(t *testing.T) {
@@ -85,19 +80,99 @@ func TestBatchImpl_Flush_withTimer(t *testing.T) {
 	b := newBatch(42, 5*time.Millisecond, mockDoOk)
 	defer b.Stop()
 	is.NotNil(b.timer)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 
-	b.buffer.values["key"] = "42"
-	b.buffer.size++
+	b.enqueue("key", "key", PriorityNormal)
 	is.NotNil(b.timer)
-	is.Len(b.buffer.values, 1)
-	is.Equal(1, b.buffer.size)
+	is.Equal(1, b.current().len())
 
 	b.Flush()
 	is.NotNil(b.timer)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
+}
+
+func TestBatchImpl_FlushAndWait(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatch(42, 0, mockDoKo)
+	defer b.Stop()
+
+	// nothing to flush
+	is.Nil(b.FlushAndWait(context.Background()))
+
+	currentBuffer := b.enqueue("key", "key", PriorityNormal)
+	is.ErrorIs(b.FlushAndWait(context.Background()), assert.AnError)
+	is.Equal(0, b.current().len())
+	is.Equal("keykey", currentBuffer.values["key"])
+	is.EqualValues(1, b.Stats().Flushes[FlushReasonManual])
+
+	// context done before the callback
+	b.Pause()
+	b.enqueue("key", "key", PriorityNormal)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	is.ErrorIs(b.FlushAndWait(ctx), context.DeadlineExceeded)
+	b.Resume()
+}
+
+func TestBatchImpl_FlushAndWait_inFlight(t *testing.T) {
+	is := assert.New(t)
+	testWithTimeout(t, 5*time.Second)
+
+	release := make(chan struct{})
+	b := newBatch(42, 0, func(keys []string) (map[string]string, error) {
+		if keys[0] == "slow" {
+			<-release
+		}
+		return mockDoKo(keys)
+	})
+	defer b.Stop()
+
+	// the current buffer is empty, but a callback is still running
+	b.enqueue("slow", "slow", PriorityNormal)
+	b.Flush()
+
+	done := make(chan error)
+	go func() {
+		done <- b.FlushAndWait(context.Background())
+	}()
+
+	select {
+	case <-done:
+		is.Fail("returned before the callback")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	is.ErrorIs(<-done, assert.AnError)
+
+	// forgotten once the callback returned
+	is.Eventually(func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.sealed) == 0
+	}, time.Second, time.Millisecond)
+
+	// buffers held by Pause()
+	b.Pause()
+	b.enqueue("a", "a", PriorityNormal)
+	b.Flush()
+	b.enqueue("b", "b", PriorityNormal)
+
+	go func() {
+		done <- b.FlushAndWait(context.Background())
+	}()
+
+	is.Eventually(func() bool {
+		b.pauseMu.Lock()
+		defer b.pauseMu.Unlock()
+		return len(b.held) == 2
+	}, time.Second, time.Millisecond)
+	b.Resume()
+
+	err := <-done
+	is.ErrorIs(err, assert.AnError)
+	is.Len(err.(interface{ Unwrap() []error }).Unwrap(), 2)
 }
 
 func TestBatchImpl_Do_noTimer(t *testing.T) {
@@ -105,16 +180,12 @@ func TestBatchImpl_Do_noTimer(t *testing.T) {
 
 	b := newBatch(3, 0, mockDoOk)
 	defer b.Stop()
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 
 	start := time.Now()
 	go func() {
 		time.Sleep(5 * time.Millisecond)
-		b.mu.Lock()
-		is.Len(b.buffer.values, 2)
-		is.Equal(2, b.buffer.size)
-		b.mu.Unlock()
+		is.Equal(2, b.current().len())
 		result, err := b.Do("1")
 		is.Nil(err)
 		is.Equal("11", result)
@@ -128,8 +199,7 @@ func TestBatchImpl_Do_noTimer(t *testing.T) {
 	is.InEpsilon(5*time.Millisecond, time.Since(start), float64(1*time.Millisecond))
 	is.Nil(err)
 	is.Equal("4242", result)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 }
 
 func TestBatchImpl_Do_withTimer(t *testing.T) {
@@ -137,16 +207,14 @@ func TestBatchImpl_Do_withTimer(t *testing.T) {
 
 	b := newBatch(42, 5*time.Millisecond, mockDoOk)
 	defer b.Stop()
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 
 	start := time.Now()
 	result, err := b.Do("42")
 	is.InEpsilon(5*time.Millisecond, time.Since(start), float64(1*time.Millisecond))
 	is.Nil(err)
 	is.Equal("4242", result)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 }
 
 func TestBatchImpl_Do_dedup(t *testing.T) {
@@ -154,15 +222,11 @@ func TestBatchImpl_Do_dedup(t *testing.T) {
 
 	b := newBatch(2, 0, mockDoOk)
 	defer b.Stop()
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 
 	go func() {
 		time.Sleep(5 * time.Millisecond)
-		b.mu.Lock()
-		is.Len(b.buffer.values, 1)
-		is.Equal(1, b.buffer.size)
-		b.mu.Unlock()
+		is.Equal(1, b.current().len())
 		result, err := b.Do("1")
 		is.Nil(err)
 		is.Equal("11", result)
@@ -175,8 +239,7 @@ func TestBatchImpl_Do_dedup(t *testing.T) {
 	result, err := b.Do("42")
 	is.Nil(err)
 	is.Equal("4242", result)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 }
 
 func TestBatchImpl_Do_error(t *testing.T) {
@@ -184,15 +247,11 @@ func TestBatchImpl_Do_error(t *testing.T) {
 
 	b := newBatch(2, 0, mockDoKo)
 	defer b.Stop()
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
 
 	go func() {
 		time.Sleep(5 * time.Millisecond)
-		b.mu.Lock()
-		is.Len(b.buffer.values, 1)
-		is.Equal(1, b.buffer.size)
-		b.mu.Unlock()
+		is.Equal(1, b.current().len())
 		result, err := b.Do("1")
 		is.Error(err)
 		is.ErrorIs(err, assert.AnError)
@@ -209,6 +268,771 @@ func TestBatchImpl_Do_error(t *testing.T) {
 	is.Error(err)
 	is.ErrorIs(err, assert.AnError)
 	is.Equal("4242", result)
-	is.Len(b.buffer.values, 0)
-	is.Equal(0, b.buffer.size)
+	is.Equal(0, b.current().len())
+}
+
+func TestBatchImpl_Do_order(t *testing.T) {
+	is := assert.New(t)
+
+	var received []string
+	b := newBatch(3, 0, func(keys []string) (map[string]string, error) {
+		received = keys
+		return mockDoOk(keys)
+	})
+	defer b.Stop()
+
+	go func() {
+		_, _ = b.Do("c")
+	}()
+	time.Sleep(2 * time.Millisecond)
+	go func() {
+		_, _ = b.Do("a")
+	}()
+	time.Sleep(2 * time.Millisecond)
+	result, err := b.Do("b")
+	is.Nil(err)
+	is.Equal("bb", result)
+	is.Equal([]string{"c", "a", "b"}, received)
+}
+
+func TestBatchImpl_Do_sorted(t *testing.T) {
+	is := assert.New(t)
+
+	var received []string
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 3,
+		key:        identity[string],
+		do: func(keys []string) (map[string]string, error) {
+			received = keys
+			return mockDoOk(keys)
+		},
+		less: func(a, b string) bool { return a < b },
+	})
+	defer b.Stop()
+
+	go func() {
+		_, _ = b.Do("c")
+	}()
+	time.Sleep(2 * time.Millisecond)
+	go func() {
+		_, _ = b.Do("a")
+	}()
+	time.Sleep(2 * time.Millisecond)
+	result, err := b.Do("b")
+	is.Nil(err)
+	is.Equal("bb", result)
+	is.Equal([]string{"a", "b", "c"}, received)
+}
+
+func TestBatchImpl_DoWithPriority_high(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatch(42, 0, mockDoOk)
+	defer b.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, err := b.Do("1")
+		is.Nil(err)
+		is.Equal("11", result)
+	}()
+	time.Sleep(2 * time.Millisecond)
+
+	result, err := b.DoWithPriority("2", PriorityHigh)
+	is.Nil(err)
+	is.Equal("22", result)
+	<-done
+	is.Equal(0, b.current().len())
+}
+
+func TestBatchImpl_DoWithPriority_low(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize:     42,
+		ttl:            5 * time.Millisecond,
+		key:            identity[string],
+		do:             mockDoOk,
+		lowPriorityTTL: 100 * time.Millisecond,
+	})
+	defer b.Stop()
+
+	// low-priority inputs only
+	start := time.Now()
+	result, err := b.DoWithPriority("1", PriorityLow)
+	is.Nil(err)
+	is.Equal("11", result)
+	is.GreaterOrEqual(time.Since(start), 100*time.Millisecond)
+
+	b.Flush()
+
+	// a normal-priority input restores the regular window
+	start = time.Now()
+	go func() {
+		time.Sleep(1 * time.Millisecond)
+		_, _ = b.Do("2")
+	}()
+	result, err = b.DoWithPriority("1", PriorityLow)
+	is.Nil(err)
+	is.Equal("11", result)
+	is.Less(time.Since(start), 50*time.Millisecond)
+}
+
+func TestBatchImpl_DoWithPriority_lowExtended(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize:     42,
+		ttl:            5 * time.Millisecond,
+		key:            identity[string],
+		do:             mockDoOk,
+		lowPriorityTTL: 100 * time.Millisecond,
+	})
+	defer b.Stop()
+
+	start := time.Now()
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+
+		b.mu.Lock()
+		is.True(b.current().extended)
+		is.Zero(atomic.LoadInt32(&b.current().prioritized))
+		b.mu.Unlock()
+
+		_, _ = b.Do("2")
+	}()
+	result, err := b.DoWithPriority("1", PriorityLow)
+	is.Nil(err)
+	is.Equal("11", result)
+	is.GreaterOrEqual(time.Since(start), 30*time.Millisecond)
+	is.Less(time.Since(start), 80*time.Millisecond)
+}
+
+func TestBatchImpl_Do_afterStop(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatch(42, 5*time.Millisecond, mockDoOk)
+	b.Stop()
+	is.EqualValues(1, b.stopped)
+
+	// dispatched right away, without timer
+	result, err := b.Do("42")
+	is.Nil(err)
+	is.Equal("4242", result)
+	is.Nil(b.timer)
+
+	b.Flush()
+	is.Nil(b.timer)
+}
+
+func TestBatchImpl_Stats(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatch(2, 0, mockDoKo)
+
+	stats := b.Stats()
+	is.Equal(0, stats.Pending)
+	is.Equal(0, stats.InFlight)
+	is.EqualValues(0, stats.Inputs)
+	is.True(stats.LastFlush.IsZero())
+	is.Len(stats.Flushes, len(flushReasons))
+
+	buffers := lo.Map([]string{"a", "a", "b", "c"}, func(input string, _ int) *buffer[string, string, string] {
+		return b.enqueue(input, input, PriorityNormal)
+	})
+	is.Equal(1, b.Stats().Pending)
+
+	b.Flush()
+	for _, buffer := range buffers {
+		<-buffer.done
+	}
+
+	stats = b.Stats()
+	is.Equal(0, stats.Pending)
+	is.Equal(0, stats.InFlight)
+	is.EqualValues(4, stats.Inputs)
+	is.EqualValues(1, stats.DedupHits)
+	is.EqualValues(1, stats.Flushes[FlushReasonSize])
+	is.EqualValues(1, stats.Flushes[FlushReasonManual])
+	is.EqualValues(2, stats.Errors)
+	is.WithinDuration(time.Now(), stats.LastFlush, time.Second)
+
+	_, _ = b.DoWithPriority("d", PriorityHigh)
+	b.Stop()
+	_, _ = b.Do("e")
+
+	// callbacks run concurrently: history order is not deterministic
+	is.ElementsMatch(
+		[]FlushEvent{
+			{Reason: FlushReasonSize, Size: 2, Err: assert.AnError},
+			{Reason: FlushReasonManual, Size: 1, Err: assert.AnError},
+		},
+		lo.Map(stats.History, func(event FlushEvent, _ int) FlushEvent {
+			return FlushEvent{Reason: event.Reason, Size: event.Size, Err: event.Err}
+		}),
+	)
+
+	stats = b.Stats()
+	is.EqualValues(1, stats.Flushes[FlushReasonPriority])
+	is.EqualValues(1, stats.Flushes[FlushReasonStop])
+	is.EqualValues(0, stats.Flushes[FlushReasonTimer])
+	is.EqualValues(4, stats.Errors)
+}
+
+func TestBatchImpl_Settings(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize:     42,
+		ttl:            5 * time.Millisecond,
+		lowPriorityTTL: 10 * time.Millisecond,
+		key:            identity[string],
+		do:             mockDoOk,
+	})
+	defer b.Stop()
+
+	is.Equal(Settings{BufferSize: 42, TTL: 5 * time.Millisecond, LowPriorityTTL: 10 * time.Millisecond}, b.Settings())
+}
+
+func TestBatchImpl_Stats_timer(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatch(42, 5*time.Millisecond, mockDoOk)
+	defer b.Stop()
+
+	_, _ = b.Do("a")
+
+	stats := b.Stats()
+	is.EqualValues(1, stats.Flushes[FlushReasonTimer])
+	is.EqualValues(0, stats.Errors)
+}
+
+func TestBatchImpl_Do_idleDispatch(t *testing.T) {
+	is := assert.New(t)
+	testWithTimeout(t, 5*time.Second)
+
+	var mu sync.Mutex
+	batches := [][]string{}
+	release := make(chan struct{})
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		ttl:        time.Hour,
+		key:        identity[string],
+		do: func(keys []string) (map[string]string, error) {
+			mu.Lock()
+			batches = append(batches, append([]string{}, keys...))
+			mu.Unlock()
+
+			if keys[0] == "a" {
+				<-release
+			}
+			return mockDoOk(keys)
+		},
+		idleDispatch: true,
+	})
+	defer b.Stop()
+
+	// nothing in flight: dispatched right away, despite the timer
+	result, err := b.Do("0")
+	is.Nil(err)
+	is.Equal("00", result)
+
+	// "a" is in flight, "b" and "c" accumulate
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		_, _ = b.Do("a")
+	}()
+	is.Eventually(func() bool {
+		return b.Stats().InFlight == 1
+	}, time.Second, time.Millisecond)
+
+	for _, input := range []string{"b", "c"} {
+		go func(input string) {
+			defer wg.Done()
+			result, err := b.Do(input)
+			is.Nil(err)
+			is.Equal(input+input, result)
+		}(input)
+	}
+	is.Eventually(func() bool {
+		return b.Stats().Pending == 2
+	}, time.Second, time.Millisecond)
+
+	// "b" and "c" are dispatched once "a" completes
+	close(release)
+	wg.Wait()
+
+	is.Equal([]string{"0"}, batches[0])
+	is.Equal([]string{"a"}, batches[1])
+	is.ElementsMatch([]string{"b", "c"}, batches[2])
+	is.EqualValues(3, b.Stats().Flushes[FlushReasonIdle])
+	is.EqualValues(0, atomic.LoadInt32(&b.dispatched))
+}
+
+func TestBatchImpl_Do_idleDispatchBoundedExecutor(t *testing.T) {
+	is := assert.New(t)
+	testWithTimeout(t, 5*time.Second)
+
+	executor := NewBoundedExecutor(1)
+	defer executor.Close()
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		ttl:        time.Hour,
+		key:        identity[string],
+		do: func(keys []string) (map[string]string, error) {
+			time.Sleep(5 * time.Millisecond)
+			return mockDoOk(keys)
+		},
+		executor:     executor,
+		idleDispatch: true,
+	})
+	defer b.Stop()
+
+	// the re-dispatch of the inputs received during a callback must not wait for the busy worker
+	for i := 0; i < 20; i++ {
+		key := strconv.Itoa(i)
+		result, err := b.Do(key)
+		is.Nil(err)
+		is.Equal(key+key, result)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := strconv.Itoa(i)
+			result, err := b.Do(key)
+			is.Nil(err)
+			is.Equal(key+key, result)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestBatchImpl_Do_striped(t *testing.T) {
+	is := assert.New(t)
+
+	var mu sync.Mutex
+	batches := [][]string{}
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 100,
+		ttl:        time.Millisecond,
+		key:        identity[string],
+		do: func(keys []string) (map[string]string, error) {
+			mu.Lock()
+			batches = append(batches, keys)
+			mu.Unlock()
+			return mockDoOk(keys)
+		},
+		stripes: 8,
+	})
+	defer b.Stop()
+	is.Len(b.index, 8)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := strconv.Itoa(i % 250)
+			result, err := b.Do(key)
+			is.Nil(err)
+			is.Equal(key+key, result)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, keys := range batches {
+		is.LessOrEqual(len(keys), 100)
+		is.Len(lo.Uniq(keys), len(keys))
+	}
+}
+
+func TestBatchImpl_Do_stripedOrder(t *testing.T) {
+	is := assert.New(t)
+
+	var received []string
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 5,
+		key:        identity[string],
+		do: func(keys []string) (map[string]string, error) {
+			received = keys
+			return mockDoOk(keys)
+		},
+		stripes: 4,
+	})
+	defer b.Stop()
+
+	for _, key := range []string{"e", "b", "d", "a"} {
+		b.enqueue(key, key, PriorityNormal)
+	}
+	result, err := b.Do("c")
+	is.Nil(err)
+	is.Equal("cc", result)
+	is.Equal([]string{"e", "b", "d", "a", "c"}, received)
+}
+
+// mutexBatch is the former implementation of Do(), serialized by a single exclusive lock, without
+// the features added since then (stats, priorities, timers). It is the baseline of BenchmarkBatchImpl_Contention.
+type mutexBatch[I comparable, O any] struct {
+	mu         sync.Mutex
+	bufferSize int
+	do         func([]I) (map[I]O, error)
+	buffer     *mutexBuffer[I, O]
+}
+
+type mutexBuffer[I comparable, O any] struct {
+	values map[I]O
+	err    error
+	done   chan struct{}
+}
+
+func newMutexBatch[I comparable, O any](bufferSize int, do func([]I) (map[I]O, error)) *mutexBatch[I, O] {
+	return &mutexBatch[I, O]{
+		bufferSize: bufferSize,
+		do:         do,
+		buffer:     &mutexBuffer[I, O]{values: map[I]O{}, done: make(chan struct{})},
+	}
+}
+
+func (b *mutexBatch[I, O]) Do(input I) (output O, err error) {
+	b.mu.Lock()
+
+	currentBuffer := b.buffer
+	if _, ok := currentBuffer.values[input]; !ok {
+		currentBuffer.values[input] = output
+	}
+
+	bufferIsFull := len(currentBuffer.values) == b.bufferSize
+	if bufferIsFull {
+		b.buffer = &mutexBuffer[I, O]{values: map[I]O{}, done: make(chan struct{})}
+	}
+
+	b.mu.Unlock()
+
+	if bufferIsFull {
+		go func() {
+			currentBuffer.values, currentBuffer.err = b.do(lo.Keys(currentBuffer.values))
+			close(currentBuffer.done)
+		}()
+	}
+
+	<-currentBuffer.done
+	return currentBuffer.values[input], currentBuffer.err
+}
+
+// BenchmarkBatchImpl_Contention compares concurrent calls to Do(), with a buffer filled by one call
+// per goroutine, against the former single-lock implementation.
+//
+//	make bench-contention
+func BenchmarkBatchImpl_Contention(b *testing.B) {
+	doNoop := func(keys []int) (map[int]int, error) {
+		return nil, nil
+	}
+
+	modes := []struct {
+		name  string
+		build func(bufferSize int) (do func(int) (int, error), stop func())
+	}{
+		{
+			name: "mutex",
+			build: func(bufferSize int) (func(int) (int, error), func()) {
+				batch := newMutexBatch(bufferSize, doNoop)
+				return batch.Do, func() {}
+			},
+		},
+		{
+			name: "default",
+			build: func(bufferSize int) (func(int) (int, error), func()) {
+				batch := newBatch(bufferSize, 0, doNoop)
+				return batch.Do, batch.Stop
+			},
+		},
+		{
+			name: "striped",
+			build: func(bufferSize int) (func(int) (int, error), func()) {
+				batch := newBatchWithOptions(batchOptions[int, int, int]{
+					bufferSize:  bufferSize,
+					key:         identity[int],
+					do:          doNoop,
+					partitioned: true,
+				})
+				return batch.Do, batch.Stop
+			},
+		},
+	}
+
+	for _, mode := range modes {
+		for _, goroutines := range []int{1, 2, 4, 8, 16, 32, 64} {
+			b.Run(fmt.Sprintf("%s/goroutines=%d", mode.name, goroutines), func(b *testing.B) {
+				do, stop := mode.build(goroutines)
+				defer stop()
+
+				// every round of calls fills one buffer
+				rounds := (b.N + goroutines - 1) / goroutines
+
+				var wg sync.WaitGroup
+				wg.Add(goroutines)
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for g := 0; g < goroutines; g++ {
+					go func(g int) {
+						defer wg.Done()
+						for i := 0; i < rounds; i++ {
+							_, _ = do(i*goroutines + g)
+						}
+					}(g)
+				}
+
+				wg.Wait()
+			})
+		}
+	}
+}
+
+func TestBatchImpl_recycle_index(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		key:        identity[string],
+		do:         mockDoOk,
+		stripes:    1,
+		pooling:    true,
+	})
+	defer b.Stop()
+
+	// recycled buffers are indexed from scratch: the key is not deduplicated with the previous batches
+	for i := 0; i < 10; i++ {
+		result, err := b.DoWithPriority("a", PriorityHigh)
+		is.Nil(err)
+		is.Equal("aa", result)
+	}
+
+	is.EqualValues(0, b.Stats().DedupHits)
+	is.Len(b.index, 1)
+	is.Equal(b.current().seq, b.index[0].seq+1)
+	is.Len(b.index[0].keys, 1)
+}
+
+func TestBatchImpl_rotate(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		key:        identity[string],
+		do:         mockDoOk,
+		stripes:    2,
+	})
+	defer b.Stop()
+
+	previous := b.current()
+
+	// a writer holding a stripe delays the rotation, and keeps writing to the current buffer
+	b.index[1].mu.Lock()
+	rotated := make(chan struct{})
+	go func() {
+		defer close(rotated)
+		b.mu.Lock()
+		b.rotate(FlushReasonManual)
+		b.mu.Unlock()
+	}()
+
+	select {
+	case <-rotated:
+		is.Fail("rotated while a writer holds a stripe")
+	case <-time.After(10 * time.Millisecond):
+	}
+	is.Equal(previous, b.current())
+
+	b.index[1].mu.Unlock()
+	<-rotated
+	is.Equal(previous.seq+1, b.current().seq)
+}
+
+// stripeKeys returns `n` keys of the given stripe.
+func stripeKeys(stripes int, stripe int, n int) []string {
+	keys := []string{}
+	for i := 0; len(keys) < n; i++ {
+		key := strconv.Itoa(i)
+		if int(hasher.Comparable(key)%uint64(stripes)) == stripe {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestBatchImpl_Do_partitioned(t *testing.T) {
+	is := assert.New(t)
+
+	var received []string
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 5,
+		key:        identity[string],
+		do: func(keys []string) (map[string]string, error) {
+			received = keys
+			return mockDoOk(keys)
+		},
+		stripes:     2,
+		partitioned: true,
+	})
+	defer b.Stop()
+	is.Equal(0, b.index[0].start)
+	is.Equal(3, b.index[0].quota)
+	is.Equal(3, b.index[1].start)
+	is.Equal(2, b.index[1].quota)
+
+	first := stripeKeys(2, 0, 4)
+	second := stripeKeys(2, 1, 1)
+
+	// the parts are merged in stripe order, and a full part borrows positions from the next one
+	b.enqueue(second[0], second[0], PriorityNormal)
+	b.enqueue(first[0], first[0], PriorityNormal)
+	b.enqueue(first[1], first[1], PriorityNormal)
+	b.enqueue(first[0], first[0], PriorityNormal)
+	b.enqueue(first[2], first[2], PriorityNormal)
+	is.Equal(4, b.Stats().Pending)
+	is.EqualValues(1, b.Stats().DedupHits)
+
+	result, err := b.Do(first[3])
+	is.Nil(err)
+	is.Equal(first[3]+first[3], result)
+	is.Equal([]string{first[0], first[1], first[2], second[0], first[3]}, received)
+	is.Equal(0, b.Stats().Pending)
+	is.EqualValues(1, b.Stats().Flushes[FlushReasonSize])
+}
+
+func TestBatchImpl_Do_partitionedPooling(t *testing.T) {
+	is := assert.New(t)
+
+	var mu sync.Mutex
+	sizes := []int{}
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		ttl:        time.Millisecond,
+		key:        identity[string],
+		do: func(keys []string) (map[string]string, error) {
+			mu.Lock()
+			sizes = append(sizes, len(keys))
+			mu.Unlock()
+			is.Len(lo.Uniq(keys), len(keys))
+			return mockDoOk(keys)
+		},
+		stripes:     4,
+		partitioned: true,
+		pooling:     true,
+	})
+	defer b.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := strconv.Itoa(i % 100)
+			result, err := b.Do(key)
+			is.Nil(err)
+			is.Equal(key+key, result)
+		}(i)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, size := range sizes {
+		is.LessOrEqual(size, 10)
+	}
+}
+
+func TestBatchImpl_Do_pooling(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		ttl:        time.Millisecond,
+		key:        identity[string],
+		do:         mockDoOk,
+		stripes:    4,
+		pooling:    true,
+	})
+	defer b.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := strconv.Itoa(i % 100)
+			result, err := b.Do(key)
+			is.Nil(err)
+			is.Equal(key+key, result)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestBatchImpl_recycle(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		key:        identity[string],
+		do:         mockDoOk,
+		pooling:    true,
+	})
+	defer b.Stop()
+
+	buf := b.current()
+	b.enqueue("a", "a", PriorityNormal) // waiter
+	b.Flush()
+	<-buf.done
+
+	// the waiter has not read its result yet
+	is.Eventually(func() bool {
+		return atomic.LoadInt32(&buf.refs) == 1
+	}, time.Second, time.Millisecond)
+	is.Equal("aa", buf.values["a"])
+
+	b.recycle(buf)
+	is.EqualValues(1, atomic.LoadInt32(&buf.refs))
+	is.Nil(buf.values)
+	is.Equal(0, buf.len())
+}
+
+// BenchmarkBatchImpl_Do_pooling measures allocations per call, with and without buffer pooling.
+func BenchmarkBatchImpl_Do_pooling(b *testing.B) {
+	for _, pooling := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pooling=%t", pooling), func(b *testing.B) {
+			batch := newBatchWithOptions(batchOptions[int, int, int]{
+				bufferSize: 16,
+				ttl:        time.Millisecond,
+				key:        identity[int],
+				do: func(keys []int) (map[int]int, error) {
+					return nil, nil
+				},
+				pooling: pooling,
+			})
+			defer batch.Stop()
+
+			var counter int64
+			b.ReportAllocs()
+			b.SetParallelism(16)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, _ = batch.Do(int(atomic.AddInt64(&counter, 1)))
+				}
+			})
+		})
+	}
 }
@@ -0,0 +1,160 @@
+// Package batchifytest provides utilities for testing code built on batchify.
+package batchifytest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samber/go-batchify"
+)
+
+var _ batchify.Clock = (*FakeClock)(nil)
+var _ batchify.Timer = (*fakeTimer)(nil)
+
+// NewFakeClock creates a manual clock, starting at `now`. Time only moves forward with Advance().
+//
+//	clock := batchifytest.NewFakeClock(time.Now())
+//	batch := batchify.NewBatchConfig(10, do).
+//		WithTimer(5*time.Millisecond).
+//		WithClock(clock).
+//		Build()
+//
+//	go batch.Do(42)
+//	batchifytest.WaitPending(t, batch, 1)
+//	clock.Advance(5*time.Millisecond) // flushes the buffer
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		mu:     sync.Mutex{},
+		now:    now,
+		timers: []*fakeTimer{},
+	}
+}
+
+// FakeClock is a batchify.Clock for deterministic tests.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// AfterFunc registers `f`, to be called by Advance() once `d` has elapsed.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) batchify.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timer := &fakeTimer{
+		clock:  c,
+		when:   c.now.Add(d),
+		f:      f,
+		active: true,
+	}
+	c.timers = append(c.timers, timer)
+
+	return timer
+}
+
+// Advance moves the time forward, and calls the functions of the expired timers in chronological order,
+// on the calling goroutine. Timers reset by these functions fire as well if they expire within `d`.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+
+		next := c.next(target)
+		if next == nil {
+			c.now = target
+			c.mu.Unlock()
+			return
+		}
+
+		c.now = next.when
+		next.active = false
+		c.mu.Unlock()
+
+		next.f()
+	}
+}
+
+// Timers returns the number of timers that have not fired or been stopped yet.
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := 0
+	for _, timer := range c.timers {
+		if timer.active {
+			count++
+		}
+	}
+
+	return count
+}
+
+// next returns the earliest active timer expiring before `target`. It must be called under mutex lock.
+func (c *FakeClock) next(target time.Time) *fakeTimer {
+	var next *fakeTimer
+	for _, timer := range c.timers {
+		if timer.active && !timer.when.After(target) && (next == nil || timer.when.Before(next.when)) {
+			next = timer
+		}
+	}
+
+	return next
+}
+
+// waitPendingTimeout bounds WaitPending.
+const waitPendingTimeout = 5 * time.Second
+
+// WaitPending waits until `batch` holds at least `pending` inputs, eg: before calling Advance() on
+// a FakeClock, as Do() is usually called from another goroutine. It fails the test after 5 seconds.
+func WaitPending[I any, O any](t testing.TB, batch batchify.Batch[I, O], pending int) {
+	t.Helper()
+
+	deadline := time.Now().Add(waitPendingTimeout)
+	for batch.Stats().Pending < pending {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d pending input(s), got %d after %s", pending, batch.Stats().Pending, waitPendingTimeout)
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type fakeTimer struct {
+	clock  *FakeClock
+	when   time.Time
+	f      func()
+	active bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.active
+	t.active = false
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.active
+	t.when = t.clock.now.Add(d)
+	t.active = true
+	return active
+}
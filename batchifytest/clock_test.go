@@ -0,0 +1,186 @@
+package batchifytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samber/go-batchify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	is := assert.New(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	is.Equal(start, clock.Now())
+	is.Equal(0, clock.Timers())
+
+	calls := []string{}
+	t1 := clock.AfterFunc(10*time.Millisecond, func() { calls = append(calls, "t1") })
+	clock.AfterFunc(5*time.Millisecond, func() { calls = append(calls, "t2") })
+	t3 := clock.AfterFunc(5*time.Millisecond, func() { calls = append(calls, "t3") })
+	is.Equal(3, clock.Timers())
+
+	is.True(t3.Stop())
+	is.False(t3.Stop())
+	is.Equal(2, clock.Timers())
+
+	clock.Advance(4 * time.Millisecond)
+	is.Empty(calls)
+	is.Equal(start.Add(4*time.Millisecond), clock.Now())
+
+	clock.Advance(6 * time.Millisecond)
+	is.Equal([]string{"t2", "t1"}, calls)
+	is.Equal(start.Add(10*time.Millisecond), clock.Now())
+	is.Equal(0, clock.Timers())
+
+	is.False(t1.Reset(time.Millisecond))
+	is.True(t1.Reset(2 * time.Millisecond))
+	clock.Advance(time.Millisecond)
+	is.Equal([]string{"t2", "t1"}, calls)
+	clock.Advance(time.Millisecond)
+	is.Equal([]string{"t2", "t1", "t1"}, calls)
+}
+
+func TestFakeClock_resetFromCallback(t *testing.T) {
+	is := assert.New(t)
+
+	clock := NewFakeClock(time.Now())
+
+	count := 0
+	var timer batchify.Timer
+	timer = clock.AfterFunc(time.Second, func() {
+		count++
+		timer.Reset(time.Second)
+	})
+
+	clock.Advance(3500 * time.Millisecond)
+	is.Equal(3, count)
+	is.Equal(1, clock.Timers())
+}
+
+func TestFakeClock_batchTimer(t *testing.T) {
+	is := assert.New(t)
+
+	clock := NewFakeClock(time.Now())
+	batch := batchify.NewBatchConfig(10, func(inputs []int) (map[int]int, error) {
+		out := map[int]int{}
+		for _, input := range inputs {
+			out[input] = input * 2
+		}
+		return out, nil
+	}).
+		WithTimer(time.Hour).
+		WithClock(clock).
+		Build()
+	defer batch.Stop()
+
+	result := make(chan int, 1)
+	go func() {
+		output, _ := batch.Do(21)
+		result <- output
+	}()
+
+	WaitPending(t, batch, 1)
+
+	clock.Advance(time.Hour - time.Nanosecond)
+	is.Equal(1, batch.Stats().Pending)
+
+	clock.Advance(time.Nanosecond)
+	is.Equal(42, <-result)
+
+	stats := batch.Stats()
+	is.EqualValues(1, stats.Flushes[batchify.FlushReasonTimer])
+	is.True(clock.Now().Equal(stats.LastFlush))
+}
+
+func TestFakeClock_batchDeadline(t *testing.T) {
+	is := assert.New(t)
+
+	// unrelated to the wall clock: deadlines are compared to the wall clock, delays elapse on the fake clock
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	recorder := NewRecorderWithContext(func(ctx context.Context, inputs []int) (map[int]int, error) {
+		if inputs[0] == 1 {
+			clock.Advance(20 * time.Millisecond) // slow callback
+		}
+
+		out := map[int]int{}
+		for _, input := range inputs {
+			out[input] = input * 2
+		}
+		return out, nil
+	})
+	batch := batchify.NewBatchConfigWithContext(10, recorder.Do).
+		WithTimer(2 * time.Hour).
+		WithClock(clock).
+		WithExecutor(batchify.InlineExecutor{}).
+		Build()
+	defer batch.Stop()
+
+	do := func(input int, deadline time.Time) chan int {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+
+		result := make(chan int, 1)
+		go func() {
+			defer cancel()
+			output, _ := batch.DoWithContext(ctx, input)
+			result <- output
+		}()
+
+		// timer and deadline timer
+		is.Eventually(func() bool {
+			return clock.Timers() == 2
+		}, time.Second, time.Millisecond)
+
+		return result
+	}
+
+	// no callback duration to learn from: flushed before the deadline, minus the margin
+	deadline := time.Now().Add(time.Hour)
+	result := do(1, deadline)
+
+	clock.Advance(time.Until(deadline) - 5*time.Millisecond - time.Second)
+	is.Equal(1, batch.Stats().Pending)
+
+	// the delay was computed a few milliseconds earlier
+	clock.Advance(2 * time.Second)
+	is.Equal(2, <-result)
+
+	// flushed before the deadline, minus the duration of the previous callback and the margin
+	deadline = time.Now().Add(time.Hour)
+	result = do(2, deadline)
+
+	clock.Advance(time.Until(deadline) - 25*time.Millisecond - time.Second)
+	is.Equal(1, batch.Stats().Pending)
+
+	clock.Advance(2 * time.Second)
+	is.Equal(4, <-result)
+
+	recorder.AssertFlushReason(t, batchify.FlushReasonDeadline)
+	recorder.AssertInvocations(t, 2)
+}
+
+func TestWaitPending(t *testing.T) {
+	is := assert.New(t)
+
+	batch := batchify.NewBatchConfig(10, func(inputs []int) (map[int]int, error) {
+		return nil, nil
+	}).Build()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = batch.Do(1)
+	}()
+
+	WaitPending(t, batch, 1)
+	is.Equal(1, batch.Stats().Pending)
+
+	batch.Stop()
+	<-done
+
+	// already reached
+	WaitPending(t, batch, 0)
+}
@@ -0,0 +1,236 @@
+package batchifytest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samber/go-batchify"
+	"go.uber.org/goleak"
+)
+
+// Config holds the settings a Factory must apply to the Batch under test.
+type Config struct {
+	BufferSize int
+	TTL        time.Duration // 0 disables the timer
+	Do         batchify.DoFunc[int, string]
+}
+
+// Factory builds the Batch under test. Every input must be routed to the same buffer, so that
+// size-based flushes are observable: sharded batches should use a single shard, or a strategy
+// mapping every input to the same shard.
+//
+//	func(cfg batchifytest.Config) batchify.Batch[int, string] {
+//		return batchify.NewBatchConfigWithContext(cfg.BufferSize, cfg.Do).WithTimer(cfg.TTL).Build()
+//	}
+type Factory func(cfg Config) batchify.Batch[int, string]
+
+// timeout of every blocking call of the suite
+const conformanceTimeout = 5 * time.Second
+
+// RunConformance checks that the batches built by `factory` follow the contract of batchify.Batch:
+// deduplication, flush on size, flush on timer, errors reaching every caller, and Stop() draining
+// the pending inputs. It also checks that no goroutine leaks. Run it with -race.
+func RunConformance(t *testing.T, factory Factory) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, factory Factory)
+	}{
+		{"Dedup", conformanceDedup},
+		{"FlushOnSize", conformanceFlushOnSize},
+		{"FlushOnTimer", conformanceFlushOnTimer},
+		{"ErrorsReachAllWaiters", conformanceErrors},
+		{"StopDrains", conformanceStop},
+		{"Concurrency", conformanceConcurrency},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+			tt.run(t, factory)
+		})
+	}
+}
+
+func conformanceDo(inputs []int) (map[int]string, error) {
+	outputs := make(map[int]string, len(inputs))
+	for _, input := range inputs {
+		outputs[input] = strconv.Itoa(input)
+	}
+
+	return outputs, nil
+}
+
+type result struct {
+	input  int
+	output string
+	err    error
+}
+
+// doAll calls Do() concurrently, and returns the results in the order of `inputs`.
+func doAll(t *testing.T, batch batchify.Batch[int, string], inputs []int) []result {
+	t.Helper()
+
+	results, wg := doAsync(batch, inputs)
+	waitTimeout(t, wg)
+
+	return results
+}
+
+// doAsync calls Do() concurrently. The results are set once the wait group is done.
+func doAsync(batch batchify.Batch[int, string], inputs []int) ([]result, *sync.WaitGroup) {
+	results := make([]result, len(inputs))
+
+	var wg sync.WaitGroup
+	wg.Add(len(inputs))
+	for i, input := range inputs {
+		go func(i int, input int) {
+			defer wg.Done()
+			output, err := batch.Do(input)
+			results[i] = result{input: input, output: output, err: err}
+		}(i, input)
+	}
+
+	return results, &wg
+}
+
+func waitTimeout(t *testing.T, wg *sync.WaitGroup) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(conformanceTimeout):
+		t.Fatalf("callers still waiting after %s", conformanceTimeout)
+	}
+}
+
+func checkResults(t *testing.T, results []result) {
+	t.Helper()
+
+	for _, r := range results {
+		if r.err != nil {
+			t.Errorf("unexpected error for input %d: %v", r.input, r.err)
+		} else if r.output != strconv.Itoa(r.input) {
+			t.Errorf("expected %q for input %d, got %q", strconv.Itoa(r.input), r.input, r.output)
+		}
+	}
+}
+
+// checkUnique checks that no invocation received the same input twice.
+func checkUnique(t *testing.T, recorder *Recorder[int, string]) {
+	t.Helper()
+
+	for i, invocation := range recorder.Invocations() {
+		seen := map[int]struct{}{}
+		for _, input := range invocation.Inputs {
+			if _, ok := seen[input]; ok {
+				t.Errorf("input %d received twice by invocation %d", input, i)
+			}
+			seen[input] = struct{}{}
+		}
+	}
+}
+
+func conformanceDedup(t *testing.T, factory Factory) {
+	recorder := NewRecorder(conformanceDo)
+	batch := factory(Config{BufferSize: 10, TTL: 200 * time.Millisecond, Do: recorder.Do})
+	defer batch.Stop()
+
+	inputs := []int{1, 1, 1, 1, 1, 1, 1, 1, 2, 2}
+	checkResults(t, doAll(t, batch, inputs))
+	checkUnique(t, recorder)
+
+	// concurrent callers are expected to share a single buffer within the window
+	recorder.AssertLoadedOnce(t, 1)
+	recorder.AssertLoadedOnce(t, 2)
+}
+
+func conformanceFlushOnSize(t *testing.T, factory Factory) {
+	recorder := NewRecorder(conformanceDo)
+	batch := factory(Config{BufferSize: 3, TTL: 0, Do: recorder.Do})
+	defer batch.Stop()
+
+	checkResults(t, doAll(t, batch, []int{1, 2, 3, 4, 5, 6}))
+	checkUnique(t, recorder)
+	recorder.AssertInvocations(t, 2)
+	recorder.AssertMaxBatchSize(t, 3)
+}
+
+func conformanceFlushOnTimer(t *testing.T, factory Factory) {
+	recorder := NewRecorder(conformanceDo)
+	batch := factory(Config{BufferSize: 100, TTL: 20 * time.Millisecond, Do: recorder.Do})
+	defer batch.Stop()
+
+	start := time.Now()
+	checkResults(t, doAll(t, batch, []int{1, 2}))
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("expected the buffer to be flushed by the timer, got results after %s", elapsed)
+	}
+
+	recorder.AssertLoadedOnce(t, 1)
+	recorder.AssertLoadedOnce(t, 2)
+}
+
+func conformanceErrors(t *testing.T, factory Factory) {
+	errFailure := errors.New("failure")
+
+	// the timer releases the duplicate input, if it comes after the first flush
+	batch := factory(Config{
+		BufferSize: 3,
+		TTL:        20 * time.Millisecond,
+		Do: func(ctx context.Context, inputs []int) (map[int]string, error) {
+			return nil, errFailure
+		},
+	})
+	defer batch.Stop()
+
+	for _, r := range doAll(t, batch, []int{1, 2, 2, 3}) {
+		if !errors.Is(r.err, errFailure) {
+			t.Errorf("expected error %v for input %d, got %v", errFailure, r.input, r.err)
+		}
+	}
+}
+
+func conformanceStop(t *testing.T, factory Factory) {
+	recorder := NewRecorder(conformanceDo)
+	batch := factory(Config{BufferSize: 100, TTL: 0, Do: recorder.Do})
+
+	results, wg := doAsync(batch, []int{1, 2, 3})
+
+	// no timer and a large buffer: only Stop() can release the callers
+	time.Sleep(20 * time.Millisecond)
+	batch.Stop()
+
+	waitTimeout(t, wg)
+	checkResults(t, results)
+	recorder.AssertLoadedOnce(t, 1)
+	recorder.AssertLoadedOnce(t, 2)
+	recorder.AssertLoadedOnce(t, 3)
+}
+
+func conformanceConcurrency(t *testing.T, factory Factory) {
+	recorder := NewRecorder(conformanceDo)
+	batch := factory(Config{BufferSize: 10, TTL: 5 * time.Millisecond, Do: recorder.Do})
+	defer batch.Stop()
+
+	inputs := []int{}
+	for i := 0; i < 1000; i++ {
+		inputs = append(inputs, i%100)
+	}
+
+	checkResults(t, doAll(t, batch, inputs))
+	checkUnique(t, recorder)
+	recorder.AssertMaxBatchSize(t, 10)
+}
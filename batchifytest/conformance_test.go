@@ -0,0 +1,58 @@
+package batchifytest
+
+import (
+	"testing"
+
+	"github.com/samber/go-batchify"
+	"github.com/samber/go-batchify/pkg/hasher"
+)
+
+func TestRunConformance_batch(t *testing.T) {
+	RunConformance(t, func(cfg Config) batchify.Batch[int, string] {
+		return batchify.NewBatchConfigWithContext(cfg.BufferSize, cfg.Do).
+			WithTimer(cfg.TTL).
+			Build()
+	})
+}
+
+func TestRunConformance_striped(t *testing.T) {
+	RunConformance(t, func(cfg Config) batchify.Batch[int, string] {
+		return batchify.NewBatchConfigWithContext(cfg.BufferSize, cfg.Do).
+			WithTimer(cfg.TTL).
+			WithAutoStriping().
+			WithBufferPooling().
+			Build()
+	})
+}
+
+func TestRunConformance_sharded(t *testing.T) {
+	RunConformance(t, func(cfg Config) batchify.Batch[int, string] {
+		// every input is routed to the first shard
+		return batchify.NewBatchConfigWithContext(cfg.BufferSize, cfg.Do).
+			WithTimer(cfg.TTL).
+			WithSharding(4, hasher.Hasher[int](func(int) uint64 { return 0 })).
+			Build()
+	})
+}
+
+func TestRunConformance_inlineExecutor(t *testing.T) {
+	RunConformance(t, func(cfg Config) batchify.Batch[int, string] {
+		return batchify.NewBatchConfigWithContext(cfg.BufferSize, cfg.Do).
+			WithTimer(cfg.TTL).
+			WithExecutor(batchify.InlineExecutor{}).
+			Build()
+	})
+}
+
+func TestRunConformance_boundedExecutor(t *testing.T) {
+	// shared by the batches of the suite, and created before its goroutine leak checks
+	executor := batchify.NewBoundedExecutor(4)
+	defer executor.Close()
+
+	RunConformance(t, func(cfg Config) batchify.Batch[int, string] {
+		return batchify.NewBatchConfigWithContext(cfg.BufferSize, cfg.Do).
+			WithTimer(cfg.TTL).
+			WithExecutor(executor).
+			Build()
+	})
+}
@@ -0,0 +1,183 @@
+package batchifytest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/samber/go-batchify"
+)
+
+var _ batchify.Batch[string, int] = (*MockBatch[string, int])(nil)
+
+// NewMockBatch creates a Batch returning canned results, for testing code that depends on batchify.Batch.
+// Inputs without a canned result return the zero value, like a callback omitting a key.
+//
+//	batch := batchifytest.NewMockBatch[int, string]().
+//		WithResult(1, "alice").
+//		WithError(2, sql.ErrNoRows).
+//		WithLatency(10*time.Millisecond)
+func NewMockBatch[I comparable, O any]() *MockBatch[I, O] {
+	return &MockBatch[I, O]{
+		mu:      sync.Mutex{},
+		results: map[I]O{},
+		errors:  map[I]error{},
+		err:     nil,
+		latency: 0,
+		calls:   []I{},
+		flushes: map[batchify.FlushReason]uint64{},
+		resumed: nil,
+	}
+}
+
+// MockBatch is a configurable batchify.Batch. It is safe for concurrent use.
+type MockBatch[I comparable, O any] struct {
+	mu      sync.Mutex
+	results map[I]O
+	errors  map[I]error
+	err     error
+	latency time.Duration
+
+	calls   []I
+	flushes map[batchify.FlushReason]uint64
+	resumed chan struct{} // closed by Resume(), or nil when not paused
+}
+
+// WithResult sets the output returned for `input`.
+func (m *MockBatch[I, O]) WithResult(input I, output O) *MockBatch[I, O] {
+	m.mu.Lock()
+	m.results[input] = output
+	m.mu.Unlock()
+	return m
+}
+
+// WithError sets the error returned for `input`.
+func (m *MockBatch[I, O]) WithError(input I, err error) *MockBatch[I, O] {
+	m.mu.Lock()
+	m.errors[input] = err
+	m.mu.Unlock()
+	return m
+}
+
+// WithDefaultError sets the error returned for inputs without a specific error, eg: to simulate an outage.
+func (m *MockBatch[I, O]) WithDefaultError(err error) *MockBatch[I, O] {
+	m.mu.Lock()
+	m.err = err
+	m.mu.Unlock()
+	return m
+}
+
+// WithLatency delays every call to Do().
+func (m *MockBatch[I, O]) WithLatency(latency time.Duration) *MockBatch[I, O] {
+	m.mu.Lock()
+	m.latency = latency
+	m.mu.Unlock()
+	return m
+}
+
+func (m *MockBatch[I, O]) Do(input I) (output O, err error) {
+	return m.DoWithPriority(input, batchify.PriorityNormal)
+}
+
+func (m *MockBatch[I, O]) DoWithPriority(input I, priority batchify.Priority) (output O, err error) {
+	return m.DoWithContext(context.Background(), input)
+}
+
+// DoWithContext returns the context error when the context is done before the latency elapsed,
+// or before Resume() when paused.
+func (m *MockBatch[I, O]) DoWithContext(ctx context.Context, input I) (output O, err error) {
+	m.mu.Lock()
+	m.calls = append(m.calls, input)
+	resumed := m.resumed
+	latency := m.latency
+	output = m.results[input]
+	err, ok := m.errors[input]
+	if !ok {
+		err = m.err
+	}
+	m.mu.Unlock()
+
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			var zero O
+			return zero, ctx.Err()
+		}
+	}
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			var zero O
+			return zero, ctx.Err()
+		}
+	}
+
+	return output, err
+}
+
+func (m *MockBatch[I, O]) Flush() {
+	m.mu.Lock()
+	m.flushes[batchify.FlushReasonManual]++
+	m.mu.Unlock()
+}
+
+// FlushAndWait counts as a manual flush. It returns nil, as no callback runs.
+func (m *MockBatch[I, O]) FlushAndWait(ctx context.Context) error {
+	m.Flush()
+	return nil
+}
+
+func (m *MockBatch[I, O]) Stop() {
+	m.mu.Lock()
+	m.flushes[batchify.FlushReasonStop]++
+	m.mu.Unlock()
+}
+
+// Pause blocks the callers of Do() until Resume().
+func (m *MockBatch[I, O]) Pause() {
+	m.mu.Lock()
+	if m.resumed == nil {
+		m.resumed = make(chan struct{})
+	}
+	m.mu.Unlock()
+}
+
+// Resume releases the callers blocked since Pause().
+func (m *MockBatch[I, O]) Resume() {
+	m.mu.Lock()
+	if m.resumed != nil {
+		close(m.resumed)
+		m.resumed = nil
+	}
+	m.mu.Unlock()
+}
+
+// Stats reports the number of calls to Do(), Flush() and Stop().
+func (m *MockBatch[I, O]) Stats() batchify.Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	flushes := map[batchify.FlushReason]uint64{}
+	for reason, count := range m.flushes {
+		flushes[reason] = count
+	}
+
+	return batchify.Stats{
+		Flushes: flushes,
+		Inputs:  uint64(len(m.calls)),
+	}
+}
+
+// Calls returns the inputs received by Do(), in call order.
+func (m *MockBatch[I, O]) Calls() []I {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]I{}, m.calls...)
+}
@@ -0,0 +1,98 @@
+package batchifytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samber/go-batchify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockBatch(t *testing.T) {
+	is := assert.New(t)
+
+	batch := NewMockBatch[int, string]().
+		WithResult(1, "alice").
+		WithResult(2, "bob").
+		WithError(2, assert.AnError)
+
+	result, err := batch.Do(1)
+	is.Nil(err)
+	is.Equal("alice", result)
+
+	result, err = batch.DoWithPriority(2, batchify.PriorityHigh)
+	is.ErrorIs(err, assert.AnError)
+	is.Equal("bob", result)
+
+	result, err = batch.Do(3)
+	is.Nil(err)
+	is.Equal("", result)
+
+	batch.WithDefaultError(assert.AnError)
+	_, err = batch.Do(3)
+	is.ErrorIs(err, assert.AnError)
+
+	is.Equal([]int{1, 2, 3, 3}, batch.Calls())
+
+	batch.Flush()
+	is.Nil(batch.FlushAndWait(context.Background()))
+	batch.Stop()
+
+	stats := batch.Stats()
+	is.EqualValues(4, stats.Inputs)
+	is.EqualValues(2, stats.Flushes[batchify.FlushReasonManual])
+	is.EqualValues(1, stats.Flushes[batchify.FlushReasonStop])
+}
+
+func TestMockBatch_latency(t *testing.T) {
+	is := assert.New(t)
+
+	batch := NewMockBatch[int, string]().
+		WithLatency(20 * time.Millisecond)
+
+	start := time.Now()
+	_, _ = batch.Do(1)
+	is.GreaterOrEqual(time.Since(start), 20*time.Millisecond)
+}
+
+func TestMockBatch_DoWithContext(t *testing.T) {
+	is := assert.New(t)
+
+	batch := NewMockBatch[int, string]().
+		WithResult(1, "alice").
+		WithLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	result, err := batch.DoWithContext(ctx, 1)
+	is.ErrorIs(err, context.DeadlineExceeded)
+	is.Equal("", result)
+	is.Equal([]int{1}, batch.Calls())
+}
+
+func TestMockBatch_Pause(t *testing.T) {
+	is := assert.New(t)
+
+	batch := NewMockBatch[int, string]().
+		WithResult(1, "alice")
+
+	batch.Pause()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := batch.DoWithContext(ctx, 1)
+	is.ErrorIs(err, context.DeadlineExceeded)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, err := batch.Do(1)
+		is.Nil(err)
+		is.Equal("alice", result)
+	}()
+
+	batch.Resume()
+	<-done
+}
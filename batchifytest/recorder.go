@@ -0,0 +1,172 @@
+package batchifytest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samber/go-batchify"
+)
+
+// Invocation describes a call to a recorded callback.
+type Invocation[I comparable, O any] struct {
+	Inputs   []I
+	Info     batchify.BatchInfo // shard, flush reason, size and dispatch time
+	Duration time.Duration      // wall-clock duration of the callback
+	Outputs  map[I]O
+	Err      error
+}
+
+// NewRecorder wraps a callback, to record every invocation.
+//
+//	recorder := batchifytest.NewRecorder(do)
+//	batch := batchify.NewBatchConfigWithContext(10, recorder.Do).Build()
+//	...
+//	recorder.AssertLoadedOnce(t, 42)
+func NewRecorder[I comparable, O any](do func([]I) (map[I]O, error)) *Recorder[I, O] {
+	return NewRecorderWithContext(func(_ context.Context, inputs []I) (map[I]O, error) {
+		return do(inputs)
+	})
+}
+
+// NewRecorderWithContext wraps a callback receiving a context, to record every invocation.
+func NewRecorderWithContext[I comparable, O any](do batchify.DoFunc[I, O]) *Recorder[I, O] {
+	return &Recorder[I, O]{
+		mu:          sync.Mutex{},
+		do:          do,
+		invocations: []Invocation[I, O]{},
+	}
+}
+
+// Recorder records the invocations of a callback. It is safe for concurrent use.
+type Recorder[I comparable, O any] struct {
+	mu          sync.Mutex
+	do          batchify.DoFunc[I, O]
+	invocations []Invocation[I, O]
+}
+
+// Do calls the wrapped callback and records the invocation. See batchify.NewBatchConfigWithContext.
+func (r *Recorder[I, O]) Do(ctx context.Context, inputs []I) (map[I]O, error) {
+	info, _ := batchify.InfoFromContext(ctx)
+
+	start := time.Now()
+	outputs, err := r.do(ctx, inputs)
+	duration := time.Since(start)
+
+	r.mu.Lock()
+	r.invocations = append(r.invocations, Invocation[I, O]{
+		Inputs:   append([]I{}, inputs...), // the slice might be recycled by the batch
+		Info:     info,
+		Duration: duration,
+		Outputs:  outputs,
+		Err:      err,
+	})
+	r.mu.Unlock()
+
+	return outputs, err
+}
+
+// Invocations returns the recorded invocations, in completion order.
+func (r *Recorder[I, O]) Invocations() []Invocation[I, O] {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Invocation[I, O]{}, r.invocations...)
+}
+
+// Inputs returns the inputs of every invocation.
+func (r *Recorder[I, O]) Inputs() []I {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inputs := []I{}
+	for _, invocation := range r.invocations {
+		inputs = append(inputs, invocation.Inputs...)
+	}
+
+	return inputs
+}
+
+// Reset forgets the recorded invocations.
+func (r *Recorder[I, O]) Reset() {
+	r.mu.Lock()
+	r.invocations = []Invocation[I, O]{}
+	r.mu.Unlock()
+}
+
+// Loads returns the number of invocations that received `input`.
+func (r *Recorder[I, O]) Loads(input I) int {
+	count := 0
+	for _, loaded := range r.Inputs() {
+		if loaded == input {
+			count++
+		}
+	}
+
+	return count
+}
+
+// AssertLoadedOnce checks that `input` has been passed to exactly one invocation.
+func (r *Recorder[I, O]) AssertLoadedOnce(t testing.TB, input I) bool {
+	t.Helper()
+	return r.AssertLoadedTimes(t, input, 1)
+}
+
+// AssertNotLoaded checks that `input` has not been passed to any invocation.
+func (r *Recorder[I, O]) AssertNotLoaded(t testing.TB, input I) bool {
+	t.Helper()
+	return r.AssertLoadedTimes(t, input, 0)
+}
+
+// AssertLoadedTimes checks that `input` has been passed to exactly `times` invocations.
+func (r *Recorder[I, O]) AssertLoadedTimes(t testing.TB, input I, times int) bool {
+	t.Helper()
+
+	if loads := r.Loads(input); loads != times {
+		t.Errorf("expected %v to be loaded %d time(s), got %d", input, times, loads)
+		return false
+	}
+
+	return true
+}
+
+// AssertInvocations checks the number of invocations.
+func (r *Recorder[I, O]) AssertInvocations(t testing.TB, count int) bool {
+	t.Helper()
+
+	if invocations := len(r.Invocations()); invocations != count {
+		t.Errorf("expected %d invocation(s), got %d", count, invocations)
+		return false
+	}
+
+	return true
+}
+
+// AssertMaxBatchSize checks that no invocation received more than `size` inputs.
+func (r *Recorder[I, O]) AssertMaxBatchSize(t testing.TB, size int) bool {
+	t.Helper()
+
+	for i, invocation := range r.Invocations() {
+		if len(invocation.Inputs) > size {
+			t.Errorf("expected batches of at most %d input(s), got %d in invocation %d", size, len(invocation.Inputs), i)
+			return false
+		}
+	}
+
+	return true
+}
+
+// AssertFlushReason checks that every invocation has been dispatched for `reason`.
+func (r *Recorder[I, O]) AssertFlushReason(t testing.TB, reason batchify.FlushReason) bool {
+	t.Helper()
+
+	for i, invocation := range r.Invocations() {
+		if invocation.Info.Reason != reason {
+			t.Errorf("expected flush reason %q, got %q in invocation %d", reason, invocation.Info.Reason, i)
+			return false
+		}
+	}
+
+	return true
+}
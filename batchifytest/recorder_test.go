@@ -0,0 +1,137 @@
+package batchifytest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/samber/go-batchify"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeT captures the failures of assertion helpers.
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func double(inputs []int) (map[int]int, error) {
+	out := map[int]int{}
+	for _, input := range inputs {
+		out[input] = input * 2
+	}
+	return out, nil
+}
+
+func TestRecorder(t *testing.T) {
+	is := assert.New(t)
+
+	recorder := NewRecorder(double)
+	batch := batchify.NewBatchConfigWithContext(2, recorder.Do).Build()
+	defer batch.Stop()
+
+	go func() {
+		_, _ = batch.Do(1)
+	}()
+	result, err := batch.Do(2)
+	is.Nil(err)
+	is.Equal(4, result)
+
+	result, err = batch.DoWithPriority(3, batchify.PriorityHigh)
+	is.Nil(err)
+	is.Equal(6, result)
+
+	invocations := recorder.Invocations()
+	is.Len(invocations, 2)
+	is.ElementsMatch([]int{1, 2}, invocations[0].Inputs)
+	is.Equal(batchify.FlushReasonSize, invocations[0].Info.Reason)
+	is.Equal(2, invocations[0].Info.Size)
+	is.Equal(map[int]int{1: 2, 2: 4}, invocations[0].Outputs)
+	is.Equal([]int{3}, invocations[1].Inputs)
+	is.Equal(batchify.FlushReasonPriority, invocations[1].Info.Reason)
+	is.Nil(invocations[1].Err)
+
+	is.ElementsMatch([]int{1, 2, 3}, recorder.Inputs())
+	is.Equal(1, recorder.Loads(3))
+	is.Equal(0, recorder.Loads(4))
+
+	is.True(recorder.AssertLoadedOnce(t, 1))
+	is.True(recorder.AssertNotLoaded(t, 4))
+	is.True(recorder.AssertInvocations(t, 2))
+	is.True(recorder.AssertMaxBatchSize(t, 2))
+
+	recorder.Reset()
+	is.Empty(recorder.Invocations())
+}
+
+func TestRecorder_timing(t *testing.T) {
+	is := assert.New(t)
+
+	clock := NewFakeClock(time.Now())
+	recorder := NewRecorder(func(inputs []int) (map[int]int, error) {
+		time.Sleep(10 * time.Millisecond)
+		return double(inputs)
+	})
+	batch := batchify.NewBatchConfigWithContext(10, recorder.Do).
+		WithTimer(time.Second).
+		WithClock(clock).
+		Build()
+	defer batch.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = batch.Do(1)
+	}()
+
+	is.Eventually(func() bool {
+		return batch.Stats().Pending == 1
+	}, time.Second, time.Millisecond)
+	clock.Advance(time.Second)
+	<-done
+
+	invocations := recorder.Invocations()
+	is.Len(invocations, 1)
+	is.True(clock.Now().Equal(invocations[0].Info.Time))
+	is.GreaterOrEqual(invocations[0].Duration, 10*time.Millisecond)
+	is.True(recorder.AssertFlushReason(t, batchify.FlushReasonTimer))
+}
+
+func TestRecorder_assertions(t *testing.T) {
+	is := assert.New(t)
+
+	recorder := NewRecorder(func(inputs []int) (map[int]int, error) {
+		return nil, assert.AnError
+	})
+	_, err := recorder.Do(context.Background(), []int{1, 2, 3})
+	is.ErrorIs(err, assert.AnError)
+	_, _ = recorder.Do(context.Background(), []int{1})
+
+	ft := &fakeT{}
+	is.False(recorder.AssertLoadedOnce(ft, 1))
+	is.False(recorder.AssertNotLoaded(ft, 2))
+	is.False(recorder.AssertLoadedTimes(ft, 3, 2))
+	is.False(recorder.AssertInvocations(ft, 1))
+	is.False(recorder.AssertMaxBatchSize(ft, 2))
+	is.False(recorder.AssertFlushReason(ft, batchify.FlushReasonSize))
+	is.Equal(
+		[]string{
+			"expected 1 to be loaded 1 time(s), got 2",
+			"expected 2 to be loaded 0 time(s), got 1",
+			"expected 3 to be loaded 2 time(s), got 1",
+			"expected 1 invocation(s), got 2",
+			"expected batches of at most 2 input(s), got 3 in invocation 0",
+			`expected flush reason "size", got "" in invocation 0`,
+		},
+		ft.errors,
+	)
+
+	is.ErrorIs(recorder.Invocations()[0].Err, assert.AnError)
+}
@@ -2,28 +2,102 @@ package batchify
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/samber/go-batchify/internal"
 )
 
-func newBuffer[I comparable, O any](bufferSize int) *buffer[I, O] {
-	b := &buffer[I, O]{
-		values: make(map[I]O, bufferSize),
+func newBuffer[I any, K comparable, O any](bufferSize int) *buffer[I, K, O] {
+	b := &buffer[I, K, O]{
+		refs:   1,
+		inputs: make([]I, bufferSize),
+		values: nil,
 		err:    nil,
-		size:   0,
 		once:   sync.Once{},
-		wg:     sync.WaitGroup{},
+		done:   make(chan struct{}),
+
+		prioritized: 0,
+		extended:    false,
+		reason:      "",
+		flushAt:     time.Time{},
+		seq:         0,
+		ctx:         infoContext{},
 	}
-	b.wg.Add(1)
 	return b
 }
 
-type buffer[I comparable, O any] struct {
+type buffer[I any, K comparable, O any] struct {
 	_ internal.NoCopy
 
-	values map[I]O
+	// the only word written by every new input, unless partitioned: first, and padded away from the fields below
+	size int32 // atomic
+	_    [60]byte
+
+	refs int32 // atomic: number of waiters, plus one until the callback returns. Only counted with pooling.
+
+	inputs []I     // deduplicated inputs, in arrival order. Only the first `size` inputs are set.
+	values map[K]O // results of the callback, indexed by input key
 	err    error
-	size   int
 	once   sync.Once
-	wg     sync.WaitGroup
+	done   chan struct{} // closed once the callback returned
+
+	prioritized int32 // atomic: 1 when holding at least one input of normal or high priority
+	extended    bool  // true when the timer has been extended for low-priority inputs
+
+	reason  FlushReason // set when the buffer is sealed
+	flushAt time.Time   // flush time required by the earliest waiter deadline, or zero. Protected by the batch mutex.
+	seq     uint64      // rank of the buffer among the published buffers. See batchImpl.rotate().
+
+	ctx infoContext // context of the callback, see batchImpl.begin()
+}
+
+// reserve returns the position of a new input, or false when the buffer is full.
+func (b *buffer[I, K, O]) reserve() (int, bool) {
+	for {
+		size := atomic.LoadInt32(&b.size)
+		if int(size) >= len(b.inputs) {
+			return 0, false
+		}
+
+		if atomic.CompareAndSwapInt32(&b.size, size, size+1) {
+			return int(size), true
+		}
+	}
+}
+
+// len returns the number of deduplicated inputs.
+func (b *buffer[I, K, O]) len() int {
+	return int(atomic.LoadInt32(&b.size))
+}
+
+// retain registers a reader of the results. See drop().
+func (b *buffer[I, K, O]) retain() {
+	atomic.AddInt32(&b.refs, 1)
+}
+
+// drop unregisters a reader of the results, and returns true when the buffer is not used anymore.
+func (b *buffer[I, K, O]) drop() bool {
+	return atomic.AddInt32(&b.refs, -1) == 0
+}
+
+// reset prepares an unused buffer for reuse.
+func (b *buffer[I, K, O]) reset() {
+	var zero I
+	for i := 0; i < b.len(); i++ {
+		b.inputs[i] = zero // release references
+	}
+
+	b.refs = 1
+	b.values = nil // owned by the callback
+	b.err = nil
+	atomic.StoreInt32(&b.size, 0) // read by callers holding a stale buffer, see batchImpl.execute
+	b.once = sync.Once{}
+	b.done = make(chan struct{})
+	atomic.StoreInt32(&b.prioritized, 0)
+	b.extended = false
+	b.reason = ""
+	b.flushAt = time.Time{}
+	b.seq = 0
+	b.ctx = infoContext{}
 }
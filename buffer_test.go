@@ -1,6 +1,7 @@
 package batchify
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,9 +11,67 @@ func TestNewBuffer(t *testing.T) {
 	is := assert.New(t)
 
 	bufferSize := 10
-	buf := newBuffer[int, string](bufferSize)
+	buf := newBuffer[int, int, string](bufferSize)
 
 	// is.Equal(bufferSize, cap(buf.values))
+	is.Len(buf.inputs, bufferSize)
+	is.Nil(buf.values)
 	is.Nil(buf.err)
-	is.Equal(0, buf.size)
+	is.Equal(0, buf.len())
+}
+
+func TestBuffer_reserve(t *testing.T) {
+	is := assert.New(t)
+
+	buf := newBuffer[int, int, string](100)
+
+	var wg sync.WaitGroup
+	positions := make([]bool, 100)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if position, ok := buf.reserve(); ok {
+				positions[position] = true
+			}
+		}()
+	}
+	wg.Wait()
+
+	is.Equal(100, buf.len())
+	is.NotContains(positions, false)
+
+	_, ok := buf.reserve()
+	is.False(ok)
+}
+
+func TestBuffer_reset(t *testing.T) {
+	is := assert.New(t)
+
+	buf := newBuffer[*int, int, string](10)
+	input := 42
+	position, ok := buf.reserve()
+	is.True(ok)
+	buf.inputs[position] = &input
+	buf.values = map[int]string{42: "42"}
+	buf.err = assert.AnError
+	buf.prioritized = 1
+	buf.extended = true
+	buf.seq = 3
+	close(buf.done)
+
+	buf.retain()         // waiter
+	is.False(buf.drop()) // callback
+	is.True(buf.drop())  // waiter
+
+	buf.reset()
+	is.Nil(buf.inputs[0])
+	is.Len(buf.inputs, 10)
+	is.Nil(buf.values)
+	is.Nil(buf.err)
+	is.Equal(0, buf.len())
+	is.EqualValues(1, buf.refs)
+	is.EqualValues(0, buf.prioritized)
+	is.False(buf.extended)
+	is.EqualValues(0, buf.seq)
 }
@@ -0,0 +1,39 @@
+package batchify
+
+import "time"
+
+// Clock provides the time to batches. It can be replaced by a fake clock in tests. See BatchConfig.WithClock.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls `f` once `d` has elapsed, like time.AfterFunc.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is implemented by *time.Timer.
+type Timer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+var _ Clock = RealClock{}
+var _ Timer = (*time.Timer)(nil)
+
+// RealClock is the default Clock, backed by the time package.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// since returns the time elapsed since `t`. With RealClock, it only reads the monotonic clock, like time.Since.
+func since(clock Clock, t time.Time) time.Duration {
+	if _, ok := clock.(RealClock); ok {
+		return time.Since(t)
+	}
+
+	return clock.Now().Sub(t)
+}
@@ -0,0 +1,27 @@
+package batchify
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealClock(t *testing.T) {
+	is := assert.New(t)
+
+	clock := RealClock{}
+	is.WithinDuration(time.Now(), clock.Now(), time.Second)
+
+	var called int32
+	timer := clock.AfterFunc(time.Millisecond, func() {
+		atomic.AddInt32(&called, 1)
+	})
+	is.IsType(&time.Timer{}, timer)
+	is.Eventually(func() bool {
+		return atomic.LoadInt32(&called) == 1
+	}, time.Second, time.Millisecond)
+
+	is.False(timer.Stop())
+}
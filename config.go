@@ -1,6 +1,8 @@
 package batchify
 
 import (
+	"context"
+	"log/slog"
 	"time"
 
 	"github.com/samber/go-batchify/pkg/hasher"
@@ -17,20 +19,97 @@ func assertValue(ok bool, msg string) {
 func NewBatchConfig[I comparable, O any](bufferSize int, do func([]I) (map[I]O, error)) BatchConfig[I, O] {
 	assertValue(bufferSize >= 1, "buffer size must be a positive value")
 	return BatchConfig[I, O]{
-		bufferSize: bufferSize,
-		do:         do,
+		commonConfig: commonConfig[I, I, O]{
+			bufferSize: bufferSize,
+		},
+		do: do,
 	}
 }
 
+// NewBatchConfigFromSlice is a builder for Batch, where `do` returns results in the same order as inputs.
+// An ErrResultsLengthMismatch error is returned to callers when `do` does not return exactly one result per input.
+func NewBatchConfigFromSlice[I comparable, O any](bufferSize int, do func([]I) ([]O, error)) BatchConfig[I, O] {
+	return NewBatchConfig(bufferSize, positional(do))
+}
+
+// NewShardedBatchConfig is a builder for sharded Batch, where `do` receives the index of the shard it serves.
+func NewShardedBatchConfig[I comparable, O any](shards int, fn hasher.Hasher[I], bufferSize int, do func(shard int, inputs []I) (map[I]O, error)) BatchConfig[I, O] {
+	assertValue(do != nil, "callback must not be nil")
+
+	cfg := NewBatchConfig[I, O](bufferSize, nil).
+		WithSharding(shards, fn)
+	cfg.shardedDo = do
+	return cfg
+}
+
+// NewBatchConfigWithContext is a builder for Batch, where `do` receives a context holding the
+// description of the batch. See InfoFromContext.
+func NewBatchConfigWithContext[I comparable, O any](bufferSize int, do DoFunc[I, O]) BatchConfig[I, O] {
+	assertValue(do != nil, "callback must not be nil")
+
+	cfg := NewBatchConfig[I, O](bufferSize, nil)
+	cfg.doWithContext = do
+	return cfg
+}
+
 type BatchConfig[I comparable, O any] struct {
+	commonConfig[I, I, O]
+
+	do            func([]I) (map[I]O, error)
+	shardedDo     func(shard int, inputs []I) (map[I]O, error)
+	doWithContext DoFunc[I, O]
+
+	// applied around the callback, the first one being the outermost
+	middlewares []Middleware[I, O]
+}
+
+// commonConfig holds the settings shared by BatchConfig and KeyedBatchConfig.
+type commonConfig[I any, K comparable, O any] struct {
+	name       string
 	bufferSize int
-	do         func([]I) (map[I]O, error)
 
 	// max buffer duration
 	ttl time.Duration
 
+	// max buffer duration for low-priority inputs
+	lowPriorityTTL time.Duration
+
+	// inputs order
+	less func(a, b I) bool
+
+	// one sub-buffer per stripe
+	partitioned bool
+
+	// recycles buffers
+	pooling bool
+
+	// optional logging
+	logger        *slog.Logger
+	slowThreshold time.Duration
+
+	clock    Clock
+	executor Executor
+
+	idleDispatch bool
+
+	// max number of waiting callers while paused
+	pauseLimit int
+
 	shards     int
-	shardingFn hasher.Hasher[I]
+	shardingFn hasher.Strategy[I]
+
+	// per-shard overrides
+	shardBufferSizes map[int]int
+	shardTTLs        map[int]time.Duration
+}
+
+// WithName names the batcher. The name is added to logs, and to the pprof labels and runtime/trace
+// tasks of the callbacks, along with the shard and flush reason.
+func (cfg BatchConfig[I, O]) WithName(name string) BatchConfig[I, O] {
+	assertValue(name != "", "name must not be empty")
+
+	cfg.name = name
+	return cfg
 }
 
 // WithTimer sets the max time for a batch buffer
@@ -41,6 +120,102 @@ func (cfg BatchConfig[I, O]) WithTimer(ttl time.Duration) BatchConfig[I, O] {
 	return cfg
 }
 
+// WithLowPriorityTimer sets the max time for a batch buffer holding low-priority inputs only.
+// It must be greater than the regular timer. See Batch.DoWithPriority.
+func (cfg BatchConfig[I, O]) WithLowPriorityTimer(ttl time.Duration) BatchConfig[I, O] {
+	assertValue(ttl >= 0, "ttl must be a positive value")
+
+	cfg.lowPriorityTTL = ttl
+	return cfg
+}
+
+// WithSort sorts the inputs of each batch with the provided comparator before calling `do`.
+// By default, inputs are passed in arrival order.
+func (cfg BatchConfig[I, O]) WithSort(less func(a, b I) bool) BatchConfig[I, O] {
+	assertValue(less != nil, "comparator must not be nil")
+
+	cfg.less = less
+	return cfg
+}
+
+// WithAutoStriping splits each buffer into one sub-buffer per stripe of the deduplication index, each with
+// its own size counter, so that new inputs of different stripes do not update the same counter. The
+// sub-buffers are merged when the buffer is flushed: unlike WithSharding, batch size and timer remain global,
+// and no hasher is required. Inputs are passed to the callback in arrival order within a stripe only.
+func (cfg BatchConfig[I, O]) WithAutoStriping() BatchConfig[I, O] {
+	cfg.partitioned = true
+	return cfg
+}
+
+// WithBufferPooling recycles buffers and input slices between batches, to reduce allocations.
+// The callback must not retain the inputs slice, nor its context, after returning: copy the inputs if needed.
+func (cfg BatchConfig[I, O]) WithBufferPooling() BatchConfig[I, O] {
+	cfg.pooling = true
+	return cfg
+}
+
+// WithLogger logs batch dispatches, completions, errors and panics of the callback. Logging is disabled by default.
+// Dispatches and completions are logged at debug level.
+func (cfg BatchConfig[I, O]) WithLogger(logger *slog.Logger) BatchConfig[I, O] {
+	assertValue(logger != nil, "logger must not be nil")
+
+	cfg.logger = logger
+	return cfg
+}
+
+// WithSlowCallbackThreshold logs a warning when the callback runs longer than `threshold`. Requires WithLogger.
+func (cfg BatchConfig[I, O]) WithSlowCallbackThreshold(threshold time.Duration) BatchConfig[I, O] {
+	assertValue(threshold >= 0, "threshold must be a positive value")
+
+	cfg.slowThreshold = threshold
+	return cfg
+}
+
+// WithClock replaces the clock used by timers and stats, eg: by batchifytest.FakeClock in tests.
+func (cfg BatchConfig[I, O]) WithClock(clock Clock) BatchConfig[I, O] {
+	assertValue(clock != nil, "clock must not be nil")
+
+	cfg.clock = clock
+	return cfg
+}
+
+// WithMiddleware wraps the callback with middlewares. The first middleware is the outermost one.
+// Middlewares access the shard and flush reason of the batch with InfoFromContext.
+func (cfg BatchConfig[I, O]) WithMiddleware(middlewares ...Middleware[I, O]) BatchConfig[I, O] {
+	for _, middleware := range middlewares {
+		assertValue(middleware != nil, "middleware must not be nil")
+	}
+
+	cfg.middlewares = append(append([]Middleware[I, O]{}, cfg.middlewares...), middlewares...)
+	return cfg
+}
+
+// WithExecutor runs the callbacks with `executor`, instead of a new goroutine per batch.
+// See InlineExecutor and NewBoundedExecutor.
+func (cfg BatchConfig[I, O]) WithExecutor(executor Executor) BatchConfig[I, O] {
+	assertValue(executor != nil, "executor must not be nil")
+
+	cfg.executor = executor
+	return cfg
+}
+
+// WithIdleDispatch dispatches inputs right away when no callback of the batch is in flight, like
+// Nagle's algorithm. Inputs only accumulate while a callback is running, and are dispatched when it
+// returns: batching under load, with near-zero added latency when idle. The size and timer limits still apply.
+func (cfg BatchConfig[I, O]) WithIdleDispatch() BatchConfig[I, O] {
+	cfg.idleDispatch = true
+	return cfg
+}
+
+// WithPauseLimit rejects callers with ErrPaused while the batch is paused, once `waiters` callers
+// are waiting. By default, a paused batch accepts every caller. See Batch.Pause.
+func (cfg BatchConfig[I, O]) WithPauseLimit(waiters int) BatchConfig[I, O] {
+	assertValue(waiters >= 1, "waiters must be a positive value")
+
+	cfg.pauseLimit = waiters
+	return cfg
+}
+
 // WithSharding enables cache sharding.
 func (cfg BatchConfig[I, O]) WithSharding(nbr int, fn hasher.Hasher[I]) BatchConfig[I, O] {
 	assertValue(nbr > 1, "shards must be greater than 1")
@@ -51,24 +226,119 @@ func (cfg BatchConfig[I, O]) WithSharding(nbr int, fn hasher.Hasher[I]) BatchCon
 	return cfg
 }
 
+// WithShardingStrategy enables cache sharding, with a custom key-to-shard mapping.
+// See hasher.NewConsistentHash and hasher.NewRendezvousHash.
+func (cfg BatchConfig[I, O]) WithShardingStrategy(nbr int, strategy hasher.Strategy[I]) BatchConfig[I, O] {
+	assertValue(nbr > 1, "shards must be greater than 1")
+	assertValue(strategy != nil, "sharding strategy must not be nil")
+
+	cfg.shards = nbr
+	cfg.shardingFn = strategy
+	return cfg
+}
+
+// WithShardBufferSize overrides the buffer size of a single shard (eg: a hot partition).
+// Build() panics when `shard` is not lower than the number of shards.
+func (cfg BatchConfig[I, O]) WithShardBufferSize(shard int, bufferSize int) BatchConfig[I, O] {
+	assertValue(shard >= 0, "shard must be a positive value")
+	assertValue(bufferSize >= 1, "buffer size must be a positive value")
+
+	cfg.shardBufferSizes = lo.Assign(cfg.shardBufferSizes, map[int]int{shard: bufferSize})
+	return cfg
+}
+
+// WithShardTimer overrides the max time for the batch buffer of a single shard.
+// Build() panics when `shard` is not lower than the number of shards.
+func (cfg BatchConfig[I, O]) WithShardTimer(shard int, ttl time.Duration) BatchConfig[I, O] {
+	assertValue(shard >= 0, "shard must be a positive value")
+	assertValue(ttl >= 0, "ttl must be a positive value")
+
+	cfg.shardTTLs = lo.Assign(cfg.shardTTLs, map[int]time.Duration{shard: ttl})
+	return cfg
+}
+
 // Build creates a new Batch instance.
 func (cfg BatchConfig[I, O]) Build() Batch[I, O] {
-	build := func(_ int) Batch[I, O] {
-		return newBatch(
-			cfg.bufferSize,
-			cfg.ttl,
-			cfg.do,
-		)
+	return cfg.build(identity[I], cfg.callback())
+}
+
+// build creates a new Batch instance, deduplicating inputs by `key`.
+func (cfg commonConfig[I, K, O]) build(key func(I) K, do func(ctx context.Context, inputs []I) (map[K]O, error)) Batch[I, O] {
+	shards := lo.Max([]int{cfg.shards, 1})
+	for shard := range cfg.shardBufferSizes {
+		assertValue(shard < shards, "shard of WithShardBufferSize must be lower than the number of shards")
+	}
+	for shard := range cfg.shardTTLs {
+		assertValue(shard < shards, "shard of WithShardTimer must be lower than the number of shards")
+	}
+
+	build := func(shard int) Batch[I, O] {
+		bufferSize := cfg.bufferSize
+		if size, ok := cfg.shardBufferSizes[shard]; ok {
+			bufferSize = size
+		}
+
+		ttl := cfg.ttl
+		if shardTTL, ok := cfg.shardTTLs[shard]; ok {
+			ttl = shardTTL
+		}
+
+		assertValue(cfg.lowPriorityTTL == 0 || (ttl > 0 && cfg.lowPriorityTTL >= ttl), "low-priority ttl must be greater than ttl")
+
+		return newBatchWithOptions(batchOptions[I, K, O]{
+			bufferSize: bufferSize,
+			ttl:        ttl,
+			key:        key,
+			do:         nil,
+			less:       cfg.less,
+			shard:      shard,
+			name:       cfg.name,
+			pooling:    cfg.pooling,
+			logger:     cfg.logger,
+			clock:      cfg.clock,
+			executor:   cfg.executor,
+
+			doWithContext:  do,
+			partitioned:    cfg.partitioned,
+			idleDispatch:   cfg.idleDispatch,
+			pauseLimit:     cfg.pauseLimit,
+			lowPriorityTTL: cfg.lowPriorityTTL,
+			slowThreshold:  cfg.slowThreshold,
+		})
 	}
 
 	if cfg.shards > 1 {
-		batches := lo.RepeatBy(cfg.shards, build)
-		return newShardedBatch(batches, cfg.shardingFn)
+		return newShardedBatch(cfg.shards, build, cfg.shardingFn)
 	}
 
 	return build(0)
 }
 
+// callback returns the callback of the batches, wrapped by the middlewares.
+func (cfg BatchConfig[I, O]) callback() DoFunc[I, O] {
+	var do DoFunc[I, O]
+
+	switch {
+	case cfg.doWithContext != nil:
+		do = cfg.doWithContext
+	case cfg.shardedDo != nil:
+		do = func(ctx context.Context, inputs []I) (map[I]O, error) {
+			info, _ := InfoFromContext(ctx)
+			return cfg.shardedDo(info.Shard, inputs)
+		}
+	default:
+		do = func(_ context.Context, inputs []I) (map[I]O, error) {
+			return cfg.do(inputs)
+		}
+	}
+
+	for i := len(cfg.middlewares) - 1; i >= 0; i-- {
+		do = cfg.middlewares[i](do)
+	}
+
+	return do
+}
+
 /**
  * Shortcuts
  */
@@ -97,3 +367,17 @@ func NewShardedBatchWithTimer[I comparable, O any](shards int, hasher hasher.Has
 		WithSharding(shards, hasher).
 		Build()
 }
+
+// NewBatchWithKey creates a new Batch instance for inputs that are not comparable (eg: structs holding slices or maps).
+// Inputs are deduplicated by the key returned by `key`, and `do` must index its results by that key.
+// See NewBatchConfigWithKey for more options.
+func NewBatchWithKey[I any, K comparable, O any](bufferSize int, key func(I) K, do func([]I) (map[K]O, error)) Batch[I, O] {
+	return NewBatchConfigWithKey(bufferSize, key, do).
+		Build()
+}
+
+func NewBatchWithKeyAndTimer[I any, K comparable, O any](bufferSize int, key func(I) K, do func([]I) (map[K]O, error), ttl time.Duration) Batch[I, O] {
+	return NewBatchConfigWithKey(bufferSize, key, do).
+		WithTimer(ttl).
+		Build()
+}
@@ -1,9 +1,15 @@
 package batchify
 
 import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/samber/go-batchify/pkg/hasher"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,6 +33,7 @@ func TestNewBatchConfig(t *testing.T) {
 	is.EqualValues(0, opts.ttl)
 	is.Equal(0, opts.shards)
 	is.Nil(opts.shardingFn)
+	is.Nil(opts.less)
 
 	is.Panics(func() {
 		opts = opts.WithTimer(-42 * time.Second)
@@ -38,6 +45,71 @@ func TestNewBatchConfig(t *testing.T) {
 	is.Equal(0, opts.shards)
 	is.Nil(opts.shardingFn)
 
+	is.Panics(func() {
+		opts = opts.WithLowPriorityTimer(-42 * time.Second)
+	})
+	opts = opts.WithLowPriorityTimer(42 * time.Second)
+	is.EqualValues(42*time.Second, opts.lowPriorityTTL)
+
+	is.False(opts.partitioned)
+	opts = opts.WithAutoStriping()
+	is.True(opts.partitioned)
+
+	is.False(opts.idleDispatch)
+	opts = opts.WithIdleDispatch()
+	is.True(opts.idleDispatch)
+
+	is.Zero(opts.pauseLimit)
+	is.Panics(func() {
+		opts = opts.WithPauseLimit(0)
+	})
+	opts = opts.WithPauseLimit(10)
+	is.Equal(10, opts.pauseLimit)
+
+	is.False(opts.pooling)
+	opts = opts.WithBufferPooling()
+	is.True(opts.pooling)
+
+	is.Nil(opts.clock)
+	is.Panics(func() {
+		opts = opts.WithClock(nil)
+	})
+	opts = opts.WithClock(RealClock{})
+	is.Equal(RealClock{}, opts.clock)
+
+	is.Nil(opts.executor)
+	is.Panics(func() {
+		opts = opts.WithExecutor(nil)
+	})
+	opts = opts.WithExecutor(InlineExecutor{})
+	is.Equal(InlineExecutor{}, opts.executor)
+
+	is.Empty(opts.name)
+	is.Panics(func() {
+		opts = opts.WithName("")
+	})
+	opts = opts.WithName("users")
+	is.Equal("users", opts.name)
+
+	is.Nil(opts.logger)
+	is.Panics(func() {
+		opts = opts.WithLogger(nil)
+	})
+	opts = opts.WithLogger(slog.Default())
+	is.Equal(slog.Default(), opts.logger)
+
+	is.Panics(func() {
+		opts = opts.WithSlowCallbackThreshold(-1 * time.Second)
+	})
+	opts = opts.WithSlowCallbackThreshold(1 * time.Second)
+	is.EqualValues(1*time.Second, opts.slowThreshold)
+
+	is.Panics(func() {
+		opts = opts.WithSort(nil)
+	})
+	opts = opts.WithSort(func(a, b string) bool { return a < b })
+	is.NotNil(opts.less)
+
 	is.Panics(func() {
 		opts = opts.WithSharding(1, func(key string) uint64 { return 0 })
 	})
@@ -53,7 +125,23 @@ func TestNewBatchConfig(t *testing.T) {
 	is.NotNil(opts.shardingFn)
 
 	is.NotPanics(func() {
-		opts.Build()
+		opts.Build().Stop()
+	})
+
+	is.Panics(func() {
+		opts = opts.WithShardingStrategy(1, hasher.NewRendezvousHash(mockHasher))
+	})
+	is.Panics(func() {
+		opts = opts.WithShardingStrategy(2, nil)
+	})
+	opts = opts.WithShardingStrategy(3, hasher.NewRendezvousHash(mockHasher))
+	is.Equal(3, opts.shards)
+	is.IsType(&hasher.RendezvousHash[string]{}, opts.shardingFn)
+	is.NotPanics(func() {
+		opts.Build().Stop()
+	})
+	is.Panics(func() {
+		opts.WithLowPriorityTimer(1 * time.Second).Build()
 	})
 
 	is.Panics(func() {
@@ -65,28 +153,28 @@ func TestHelperNewBatch(t *testing.T) {
 	is := assert.New(t)
 
 	batch := NewBatch(42, mockDoOk)
-	b, ok := batch.(*batchImpl[string, string])
+	b, ok := batch.(*batchImpl[string, string, string])
 	is.True(ok)
 	is.Nil(b.timer)
 	// is.NotNil(b.mu)
 	is.Equal(42, b.bufferSize)
 	is.EqualValues(0, b.ttl)
 	is.NotNil(b.do)
-	is.NotNil(b.buffer)
+	is.NotNil(b.current())
 }
 
 func TestHelperNewBatchWithTimer(t *testing.T) {
 	is := assert.New(t)
 
 	batch := NewBatchWithTimer(42, mockDoOk, 21*time.Second)
-	b, ok := batch.(*batchImpl[string, string])
+	b, ok := batch.(*batchImpl[string, string, string])
 	is.True(ok)
 	is.NotNil(b.timer)
 	// is.NotNil(b.mu)
 	is.Equal(42, b.bufferSize)
 	is.Equal(21*time.Second, b.ttl)
 	is.NotNil(b.do)
-	is.NotNil(b.buffer)
+	is.NotNil(b.current())
 }
 
 func TestHelperNewShardedBatch(t *testing.T) {
@@ -95,16 +183,16 @@ func TestHelperNewShardedBatch(t *testing.T) {
 	batch := NewShardedBatch(2, mockHasher, 42, mockDoOk)
 	b, ok := batch.(*shardedBatchImpl[string, string])
 	is.True(ok)
-	is.Len(b.batches, 2)
+	is.Len(b.routes().batches, 2)
 	is.NotNil(b.shardingFn)
-	for i := range b.batches {
-		bb := b.batches[i].(*batchImpl[string, string])
+	for i := range b.routes().batches {
+		bb := b.routes().batches[i].(*batchImpl[string, string, string])
 		is.Nil(bb.timer)
 		// is.NotNil(bb.mu)
 		is.Equal(42, bb.bufferSize)
 		is.EqualValues(0, bb.ttl)
 		is.NotNil(bb.do)
-		is.NotNil(bb.buffer)
+		is.NotNil(bb.current())
 	}
 }
 
@@ -114,15 +202,297 @@ func TestHelperNewShardedBatchWithTimer(t *testing.T) {
 	batch := NewShardedBatchWithTimer(2, mockHasher, 42, mockDoOk, 21*time.Second)
 	b, ok := batch.(*shardedBatchImpl[string, string])
 	is.True(ok)
-	is.Len(b.batches, 2)
+	is.Len(b.routes().batches, 2)
 	is.NotNil(b.shardingFn)
-	for i := range b.batches {
-		bb := b.batches[i].(*batchImpl[string, string])
+	for i := range b.routes().batches {
+		bb := b.routes().batches[i].(*batchImpl[string, string, string])
 		is.NotNil(bb.timer)
 		// is.NotNil(bb.mu)
 		is.Equal(42, bb.bufferSize)
 		is.Equal(21*time.Second, bb.ttl)
 		is.NotNil(bb.do)
-		is.NotNil(bb.buffer)
+		is.NotNil(bb.current())
 	}
 }
+
+func TestHelperNewBatchWithKey(t *testing.T) {
+	is := assert.New(t)
+
+	type query struct {
+		id      int
+		filters []string
+	}
+
+	batch := NewBatchWithKey(
+		2,
+		func(q query) int { return q.id },
+		func(queries []query) (map[int]int, error) {
+			is.Len(queries, 2)
+			return lo.SliceToMap(queries, func(q query) (int, int) {
+				return q.id, q.id * len(q.filters)
+			}), nil
+		},
+	)
+	defer batch.Stop()
+
+	b, ok := batch.(*batchImpl[query, int, int])
+	is.True(ok)
+	is.Nil(b.timer)
+	is.Equal(2, b.bufferSize)
+	is.NotNil(b.key)
+
+	go func() {
+		result, err := batch.Do(query{id: 1, filters: []string{"a", "b"}})
+		is.Nil(err)
+		is.Equal(2, result)
+	}()
+	go func() {
+		// deduplicated with the previous call
+		result, err := batch.Do(query{id: 1, filters: []string{"a", "b"}})
+		is.Nil(err)
+		is.Equal(2, result)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	result, err := batch.Do(query{id: 2, filters: []string{"a", "b", "c"}})
+	is.Nil(err)
+	is.Equal(6, result)
+
+	is.Panics(func() {
+		_ = NewBatchWithKey[query, int, int](2, nil, nil)
+	})
+}
+
+func TestHelperNewBatchWithKeyAndTimer(t *testing.T) {
+	is := assert.New(t)
+
+	batch := NewBatchWithKeyAndTimer(
+		42,
+		func(s []string) string { return strings.Join(s, ",") },
+		func(inputs [][]string) (map[string]int, error) {
+			return lo.SliceToMap(inputs, func(s []string) (string, int) {
+				return strings.Join(s, ","), len(s)
+			}), nil
+		},
+		5*time.Millisecond,
+	)
+	defer batch.Stop()
+
+	b, ok := batch.(*batchImpl[[]string, string, int])
+	is.True(ok)
+	is.NotNil(b.timer)
+	is.Equal(5*time.Millisecond, b.ttl)
+
+	result, err := batch.Do([]string{"a", "b"})
+	is.Nil(err)
+	is.Equal(2, result)
+}
+
+func TestNewBatchConfigFromSlice(t *testing.T) {
+	is := assert.New(t)
+
+	batch := NewBatchConfigFromSlice(2, func(keys []string) ([]int, error) {
+		return lo.Map(keys, func(key string, _ int) int { return len(key) }), nil
+	}).Build()
+	defer batch.Stop()
+
+	go func() {
+		result, err := batch.Do("abc")
+		is.Nil(err)
+		is.Equal(3, result)
+	}()
+	result, err := batch.Do("a")
+	is.Nil(err)
+	is.Equal(1, result)
+
+	is.Panics(func() {
+		_ = NewBatchConfigFromSlice(0, func(keys []string) ([]int, error) { return nil, nil })
+	})
+}
+
+func TestNewBatchConfigWithContext(t *testing.T) {
+	is := assert.New(t)
+
+	var mu sync.Mutex
+	infos := []BatchInfo{}
+
+	cfg := NewBatchConfigWithContext(42, func(ctx context.Context, keys []string) (map[string]string, error) {
+		info, ok := InfoFromContext(ctx)
+		is.True(ok)
+
+		mu.Lock()
+		infos = append(infos, info)
+		mu.Unlock()
+		return mockDoOk(keys)
+	})
+	is.Nil(cfg.do)
+	is.NotNil(cfg.doWithContext)
+
+	batch := cfg.WithSharding(2, mockHasher).Build()
+	defer batch.Stop()
+
+	result, err := batch.DoWithPriority("a", PriorityHigh)
+	is.Nil(err)
+	is.Equal("aa", result)
+
+	result, err = batch.DoWithPriority("ab", PriorityHigh)
+	is.Nil(err)
+	is.Equal("abab", result)
+
+	is.Len(infos, 2)
+	is.Equal(1, infos[0].Shard)
+	is.Equal(0, infos[1].Shard)
+	is.Equal(FlushReasonPriority, infos[0].Reason)
+	is.Equal(1, infos[0].Size)
+	is.False(infos[0].Time.IsZero())
+
+	is.Panics(func() {
+		_ = NewBatchConfigWithContext[string, string](42, nil)
+	})
+}
+
+func TestBatchConfig_WithMiddleware(t *testing.T) {
+	is := assert.New(t)
+
+	var mu sync.Mutex
+	calls := []string{}
+
+	trace := func(name string) Middleware[string, string] {
+		return func(next DoFunc[string, string]) DoFunc[string, string] {
+			return func(ctx context.Context, inputs []string) (map[string]string, error) {
+				info, ok := InfoFromContext(ctx)
+				is.True(ok)
+				is.Equal(FlushReasonPriority, info.Reason)
+
+				mu.Lock()
+				calls = append(calls, name)
+				mu.Unlock()
+				return next(ctx, inputs)
+			}
+		}
+	}
+
+	cfg := NewBatchConfig(42, mockDoOk).
+		WithMiddleware(trace("a"), trace("b"))
+	cfg2 := cfg.WithMiddleware(trace("c"))
+	is.Len(cfg.middlewares, 2)
+	is.Len(cfg2.middlewares, 3)
+
+	batch := cfg2.Build()
+	defer batch.Stop()
+
+	result, err := batch.DoWithPriority("a", PriorityHigh)
+	is.Nil(err)
+	is.Equal("aa", result)
+	is.Equal([]string{"a", "b", "c"}, calls)
+
+	is.Panics(func() {
+		_ = cfg.WithMiddleware(nil)
+	})
+}
+
+func TestNewShardedBatchConfig(t *testing.T) {
+	is := assert.New(t)
+
+	var mu sync.Mutex
+	served := map[int][]string{}
+
+	cfg := NewShardedBatchConfig(3, mockHasher, 42, func(shard int, keys []string) (map[string]string, error) {
+		mu.Lock()
+		served[shard] = append(served[shard], keys...)
+		mu.Unlock()
+		return mockDoOk(keys)
+	})
+	is.Equal(3, cfg.shards)
+	is.Nil(cfg.do)
+	is.NotNil(cfg.shardedDo)
+
+	batch := cfg.Build()
+	defer batch.Stop()
+
+	for _, key := range []string{"a", "ab", "abc", "abcd"} {
+		result, err := batch.DoWithPriority(key, PriorityHigh)
+		is.Nil(err)
+		is.Equal(key+key, result)
+	}
+	is.Equal(map[int][]string{0: {"abc"}, 1: {"a", "abcd"}, 2: {"ab"}}, served)
+
+	is.Panics(func() {
+		_ = NewShardedBatchConfig[string, string](3, mockHasher, 42, nil)
+	})
+}
+
+func TestBatchConfig_shardOverrides(t *testing.T) {
+	is := assert.New(t)
+
+	base := NewBatchConfig(42, mockDoOk).
+		WithTimer(21*time.Second).
+		WithSharding(3, mockHasher)
+
+	is.Panics(func() {
+		base.WithShardBufferSize(-1, 10)
+	})
+	is.Panics(func() {
+		base.WithShardBufferSize(1, 0)
+	})
+	is.Panics(func() {
+		base.WithShardTimer(-1, time.Second)
+	})
+	is.Panics(func() {
+		base.WithShardTimer(1, -time.Second)
+	})
+
+	cfg := base.
+		WithShardBufferSize(1, 10).
+		WithShardTimer(2, 0).
+		WithShardTimer(1, time.Second)
+	is.Equal(map[int]int{1: 10}, cfg.shardBufferSizes)
+	is.Equal(map[int]time.Duration{1: time.Second, 2: 0}, cfg.shardTTLs)
+	is.Nil(base.shardBufferSizes)
+	is.Nil(base.shardTTLs)
+
+	// out of range shards
+	is.Panics(func() {
+		base.WithShardBufferSize(3, 10).Build()
+	})
+	is.Panics(func() {
+		base.WithShardTimer(3, time.Second).Build()
+	})
+	is.Panics(func() {
+		NewBatchConfig(42, mockDoOk).WithShardTimer(1, time.Second).Build()
+	})
+	is.NotPanics(func() {
+		NewBatchConfig(42, mockDoOk).WithShardTimer(0, time.Second).Build().Stop()
+	})
+
+	batch := cfg.Build()
+	defer batch.Stop()
+
+	b, ok := batch.(*shardedBatchImpl[string, string])
+	is.True(ok)
+	is.Len(b.routes().batches, 3)
+
+	bb := b.routes().batches[0].(*batchImpl[string, string, string])
+	is.Equal(0, bb.shard)
+	is.Equal(42, bb.bufferSize)
+	is.Equal(21*time.Second, bb.ttl)
+	is.NotNil(bb.timer)
+
+	bb = b.routes().batches[1].(*batchImpl[string, string, string])
+	is.Equal(1, bb.shard)
+	is.Equal(10, bb.bufferSize)
+	is.Equal(time.Second, bb.ttl)
+	is.NotNil(bb.timer)
+
+	bb = b.routes().batches[2].(*batchImpl[string, string, string])
+	is.Equal(2, bb.shard)
+	is.Equal(42, bb.bufferSize)
+	is.EqualValues(0, bb.ttl)
+	is.Nil(bb.timer)
+
+	// overrides apply to new shards
+	b.Resize(4)
+	bb = b.routes().batches[1].(*batchImpl[string, string, string])
+	is.Equal(10, bb.bufferSize)
+	bb = b.routes().batches[3].(*batchImpl[string, string, string])
+	is.Equal(42, bb.bufferSize)
+}
@@ -0,0 +1,94 @@
+package batchify
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// deadlineMargin is subtracted from the flush time of buffers holding a waiter with a deadline,
+// on top of the estimated callback duration, to cover scheduling delays and the variance of the callback.
+const deadlineMargin = 5 * time.Millisecond
+
+// deadlinePercentile of the recent callback durations is used as the estimated callback duration.
+const deadlinePercentile = 0.9
+
+// trackDeadline flushes `currentBuffer` early enough for a waiter with `deadline` to receive its result:
+// at `deadline` minus the estimated callback duration and deadlineMargin. While no callback completed,
+// the estimate is zero: only close deadlines flush the buffer early. Deadlines are compared to the wall
+// clock, like context deadlines, while the delay until the flush elapses on the clock of the batch.
+// Unlike Do(), it takes the mutex: it is only called for contexts with a deadline.
+func (b *batchImpl[I, K, O]) trackDeadline(currentBuffer *buffer[I, K, O], deadline time.Time) {
+	estimate, _ := b.counters.estimate()
+	flushAt := deadline.Add(-estimate - deadlineMargin)
+
+	b.mu.Lock()
+
+	// already dispatched, or an earlier waiter requires an earlier flush
+	if b.current() != currentBuffer || (!currentBuffer.flushAt.IsZero() && !flushAt.Before(currentBuffer.flushAt)) {
+		b.mu.Unlock()
+		return
+	}
+
+	currentBuffer.flushAt = flushAt
+
+	if delay := time.Until(flushAt); delay > 0 && atomic.LoadInt32(&b.stopped) == 0 {
+		// a new timer per flush time, so that a stale timer cannot flush the next buffer
+		if b.deadlineTimer != nil {
+			b.deadlineTimer.Stop()
+		}
+		b.deadlineTimer = b.clock.AfterFunc(delay, func() {
+			b.onDeadline(currentBuffer)
+		})
+
+		b.mu.Unlock()
+		return
+	}
+
+	b.mu.Unlock()
+
+	b.swap(currentBuffer, FlushReasonDeadline)
+}
+
+// onDeadline flushes `currentBuffer`, unless it has already been dispatched.
+func (b *batchImpl[I, K, O]) onDeadline(currentBuffer *buffer[I, K, O]) {
+	b.mu.Lock()
+
+	// a recycled buffer might be current again, without any deadline
+	if b.current() != currentBuffer || currentBuffer.flushAt.IsZero() {
+		b.mu.Unlock()
+		return
+	}
+
+	b.mu.Unlock()
+
+	b.swap(currentBuffer, FlushReasonDeadline)
+}
+
+// estimate returns a high percentile of the recent callback durations, or false when no callback completed yet.
+func (c *counters) estimate() (time.Duration, bool) {
+	c.mu.Lock()
+
+	size := c.events
+	if size > historySize {
+		size = historySize
+	}
+
+	var durations [historySize]time.Duration
+	for i := 0; i < size; i++ {
+		durations[i] = c.history[i].Duration
+	}
+
+	c.mu.Unlock()
+
+	if size == 0 {
+		return 0, false
+	}
+
+	sorted := durations[:size]
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	return sorted[int(float64(size-1)*deadlinePercentile)], true
+}
@@ -0,0 +1,191 @@
+package batchify
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchImpl_DoWithContext_deadline(t *testing.T) {
+	is := assert.New(t)
+
+	reasons := make(chan FlushReason, 1)
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		ttl:        time.Hour,
+		key:        identity[string],
+		doWithContext: func(ctx context.Context, inputs []string) (map[string]string, error) {
+			info, _ := InfoFromContext(ctx)
+			reasons <- info.Reason
+			return mockDoOk(inputs)
+		},
+	})
+	defer b.Stop()
+
+	// no callback duration to learn from: a far deadline does not flush the buffer
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	go func() {
+		_, _ = b.DoWithContext(ctx, "a")
+	}()
+	is.Eventually(func() bool {
+		return b.Stats().Pending == 1
+	}, time.Second, time.Millisecond)
+
+	// a close deadline does, ahead of the margin
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	result, err := b.DoWithContext(ctx, "b")
+	is.Nil(err)
+	is.Equal("bb", result)
+	is.Equal(FlushReasonDeadline, <-reasons)
+	is.EqualValues(1, b.Stats().Flushes[FlushReasonDeadline])
+
+	// without deadline
+	go func() {
+		_, _ = b.DoWithContext(context.Background(), "c")
+	}()
+	is.Eventually(func() bool {
+		return b.Stats().Pending == 1
+	}, time.Second, time.Millisecond)
+	b.Flush()
+	is.Equal(FlushReasonManual, <-reasons)
+}
+
+func TestBatchImpl_DoWithContext_canceled(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatch(10, 0, mockDoOk)
+	defer b.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, err := b.DoWithContext(ctx, "a")
+		is.ErrorIs(err, context.Canceled)
+		is.Equal("", result)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	<-done
+
+	// the input is still dispatched for the other waiters
+	is.Equal(1, b.current().len())
+	currentBuffer := b.enqueue("a", "a", PriorityHigh)
+	<-currentBuffer.done
+	is.Equal("aa", currentBuffer.values["a"])
+}
+
+func TestBatchImpl_trackDeadline(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatch(10, time.Hour, mockDoOk)
+	defer b.Stop()
+
+	b.counters.record(FlushEvent{Duration: 20 * time.Millisecond})
+
+	// flushed at the deadline, minus the estimated callback duration
+	deadline := time.Now().Add(time.Hour)
+	currentBuffer := b.enqueue("a", "a", PriorityNormal)
+	b.trackDeadline(currentBuffer, deadline)
+	is.Equal(deadline.Add(-20*time.Millisecond-deadlineMargin), currentBuffer.flushAt)
+
+	// a later deadline does not delay the flush
+	flushAt := currentBuffer.flushAt
+	b.trackDeadline(currentBuffer, deadline.Add(time.Hour))
+	is.Equal(flushAt, currentBuffer.flushAt)
+
+	// an expired deadline flushes right away
+	b.trackDeadline(currentBuffer, time.Now().Add(-time.Second))
+	<-currentBuffer.done
+	is.Equal(FlushReasonDeadline, currentBuffer.reason)
+	is.NotSame(currentBuffer, b.current())
+
+	// the stale deadline timer does not flush the next buffer
+	b.enqueue("b", "b", PriorityNormal)
+	b.onDeadline(currentBuffer)
+	is.Equal(1, b.current().len())
+}
+
+func TestBatchImpl_trackDeadline_noEstimate(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatch(10, time.Hour, mockDoOk)
+	defer b.Stop()
+
+	// flushed at the deadline, minus the margin
+	deadline := time.Now().Add(time.Hour)
+	currentBuffer := b.enqueue("a", "a", PriorityNormal)
+	b.trackDeadline(currentBuffer, deadline)
+	is.Equal(deadline.Add(-deadlineMargin), currentBuffer.flushAt)
+	is.Same(currentBuffer, b.current())
+
+	// concurrent waiters with far deadlines are batched together
+	for _, input := range []string{"b", "c"} {
+		b.trackDeadline(b.enqueue(input, input, PriorityNormal), deadline)
+	}
+	is.Equal(3, b.current().len())
+}
+
+func TestBatchImpl_DoWithContext_farDeadlines(t *testing.T) {
+	is := assert.New(t)
+
+	var calls int32
+	b := newBatch(100, 10*time.Millisecond, func(keys []string) (map[string]string, error) {
+		atomic.AddInt32(&calls, 1)
+		return mockDoOk(keys)
+	})
+	defer b.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// a fresh batch keeps batching callers with far deadlines
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := strconv.Itoa(i)
+			result, err := b.DoWithContext(ctx, key)
+			is.Nil(err)
+			is.Equal(key+key, result)
+		}(i)
+	}
+
+	wg.Wait()
+	is.EqualValues(0, b.Stats().Flushes[FlushReasonDeadline])
+	is.Less(atomic.LoadInt32(&calls), int32(50))
+}
+
+func TestCounters_estimate(t *testing.T) {
+	is := assert.New(t)
+
+	c := counters{}
+	_, ok := c.estimate()
+	is.False(ok)
+
+	for i := 10; i >= 1; i-- {
+		c.record(FlushEvent{Duration: time.Duration(i) * time.Millisecond})
+	}
+	estimate, ok := c.estimate()
+	is.True(ok)
+	is.Equal(9*time.Millisecond, estimate)
+
+	// recent callbacks only
+	for i := 0; i < historySize; i++ {
+		c.record(FlushEvent{Duration: time.Millisecond})
+	}
+	estimate, _ = c.estimate()
+	is.Equal(time.Millisecond, estimate)
+}
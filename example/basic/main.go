@@ -21,7 +21,7 @@ func mockSQL(ids []int) (map[int]string, error) {
 func main() {
 	// batch := batchify.NewShardedBatchWithTimer(
 	// 	5,
-	// 	func(key int) uint64 { return uint64(key) },
+	// 	hasher.Int[int],
 	// 	10,
 	// 	mockSQL,
 	// 	2*time.Second,
@@ -0,0 +1,84 @@
+package batchify
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrCallbackPanic is returned to the callers when the callback panics. The panic is raised again on
+// the executor goroutine, once the callers are released.
+var ErrCallbackPanic = errors.New("batch callback panicked")
+
+// Executor runs the batch callbacks. See BatchConfig.WithExecutor.
+type Executor interface {
+	// Execute runs `task`, now or later. The callers of the batch wait for its completion.
+	Execute(task func())
+}
+
+var _ Executor = DefaultExecutor{}
+var _ Executor = InlineExecutor{}
+var _ Executor = (*BoundedExecutor)(nil)
+
+// DefaultExecutor runs each callback on a new goroutine.
+type DefaultExecutor struct{}
+
+func (DefaultExecutor) Execute(task func()) {
+	go task()
+}
+
+// InlineExecutor runs each callback on the goroutine that filled the buffer: a caller of Do(),
+// the timer goroutine or a caller of Flush(). It saves a goroutine per batch, but delays the caller
+// until the callback returns.
+type InlineExecutor struct{}
+
+func (InlineExecutor) Execute(task func()) {
+	task()
+}
+
+// NewBoundedExecutor creates an Executor running callbacks on a pool of `workers` goroutines.
+// When every worker is busy, Execute() blocks, which slows down the callers filling the buffers.
+// A BoundedExecutor can be shared between batches. It must be closed once the batches are stopped.
+func NewBoundedExecutor(workers int) *BoundedExecutor {
+	assertValue(workers >= 1, "workers must be a positive value")
+
+	e := &BoundedExecutor{
+		tasks: make(chan func()),
+		wg:    sync.WaitGroup{},
+		once:  sync.Once{},
+	}
+
+	e.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go e.work()
+	}
+
+	return e
+}
+
+// BoundedExecutor is an Executor with a fixed number of goroutines.
+type BoundedExecutor struct {
+	tasks chan func()
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+func (e *BoundedExecutor) Execute(task func()) {
+	e.tasks <- task
+}
+
+// Close stops the workers, once the running callbacks return. Execute() must not be called afterwards.
+func (e *BoundedExecutor) Close() {
+	e.once.Do(func() {
+		close(e.tasks)
+	})
+
+	e.wg.Wait()
+}
+
+func (e *BoundedExecutor) work() {
+	defer e.wg.Done()
+
+	for task := range e.tasks {
+		task()
+	}
+}
@@ -0,0 +1,196 @@
+package batchify
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultExecutor(t *testing.T) {
+	is := assert.New(t)
+
+	done := make(chan struct{})
+	DefaultExecutor{}.Execute(func() {
+		close(done)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		is.Fail("task not executed")
+	}
+}
+
+func TestInlineExecutor(t *testing.T) {
+	is := assert.New(t)
+
+	called := false
+	InlineExecutor{}.Execute(func() {
+		called = true
+	})
+	is.True(called)
+}
+
+func TestBoundedExecutor(t *testing.T) {
+	is := assert.New(t)
+
+	is.Panics(func() {
+		NewBoundedExecutor(0)
+	})
+
+	e := NewBoundedExecutor(2)
+
+	var running, maxRunning, done int32
+	var wg sync.WaitGroup
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		e.Execute(func() {
+			defer wg.Done()
+
+			current := atomic.AddInt32(&running, 1)
+			for {
+				previous := atomic.LoadInt32(&maxRunning)
+				if current <= previous || atomic.CompareAndSwapInt32(&maxRunning, previous, current) {
+					break
+				}
+			}
+
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&done, 1)
+		})
+	}
+
+	wg.Wait()
+	is.EqualValues(10, done)
+	is.LessOrEqual(atomic.LoadInt32(&maxRunning), int32(2))
+
+	e.Close()
+	e.Close()
+}
+
+func TestBatchImpl_executor(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 2,
+		key:        identity[string],
+		do:         mockDoOk,
+		executor:   InlineExecutor{},
+	})
+	defer b.Stop()
+
+	// the buffer is dispatched by the second caller, on its own goroutine
+	go func() {
+		_, _ = b.Do("a")
+	}()
+	is.Eventually(func() bool {
+		return b.current().len() == 1
+	}, time.Second, time.Millisecond)
+
+	result, err := b.Do("b")
+	is.Nil(err)
+	is.Equal("bb", result)
+	is.Equal(0, b.Stats().InFlight)
+	is.EqualValues(1, b.Stats().Flushes[FlushReasonSize])
+}
+
+// recoveringExecutor runs tasks on a new goroutine, and reports their panics.
+type recoveringExecutor struct {
+	panics chan any
+}
+
+func (e recoveringExecutor) Execute(task func()) {
+	go func() {
+		defer func() {
+			e.panics <- recover()
+		}()
+
+		task()
+	}()
+}
+
+func TestBatchImpl_execute_panic(t *testing.T) {
+	is := assert.New(t)
+
+	executor := recoveringExecutor{panics: make(chan any, 1)}
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		key:        identity[string],
+		do: func(keys []string) (map[string]string, error) {
+			panic("boom")
+		},
+		executor:     executor,
+		idleDispatch: true,
+	})
+
+	// nothing in flight: dispatched right away
+	currentBuffer := b.enqueue("a", "a", PriorityNormal)
+	is.Equal("boom", <-executor.panics)
+	<-currentBuffer.done
+	is.ErrorIs(currentBuffer.err, ErrCallbackPanic)
+
+	stats := b.Stats()
+	is.EqualValues(0, stats.InFlight)
+	is.EqualValues(1, stats.Errors)
+	is.EqualValues(0, atomic.LoadInt32(&b.dispatched))
+
+	// idle dispatch still works
+	currentBuffer = b.enqueue("b", "b", PriorityNormal)
+	is.Equal("boom", <-executor.panics)
+	<-currentBuffer.done
+	is.ErrorIs(currentBuffer.err, ErrCallbackPanic)
+	is.EqualValues(2, b.Stats().Errors)
+
+	b.Stop()
+}
+
+func TestBatchImpl_execute_panicInline(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		key:        identity[string],
+		do: func(keys []string) (map[string]string, error) {
+			panic("boom")
+		},
+		executor: InlineExecutor{},
+	})
+
+	// the panic unwinds into the caller filling the buffer, the other waiters get an error
+	waiter := b.enqueue("a", "a", PriorityNormal)
+	is.PanicsWithValue("boom", func() {
+		_, _ = b.DoWithPriority("b", PriorityHigh)
+	})
+
+	<-waiter.done
+	is.ErrorIs(waiter.err, ErrCallbackPanic)
+	is.EqualValues(0, b.Stats().InFlight)
+}
+
+func TestBatchImpl_execute_panicInlinePooling(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		key:        identity[string],
+		do: func(keys []string) (map[string]string, error) {
+			panic("boom")
+		},
+		executor: InlineExecutor{},
+		pooling:  true,
+	})
+
+	waiter := b.enqueue("a", "a", PriorityNormal)
+	is.PanicsWithValue("boom", func() {
+		_, _ = b.DoWithPriority("b", PriorityHigh)
+	})
+
+	// the caller that panicked released its reference: the buffer goes back to the pool with the last waiter
+	<-waiter.done
+	is.EqualValues(1, atomic.LoadInt32(&waiter.refs))
+	b.recycle(waiter)
+}
@@ -1,6 +1,6 @@
 module github.com/samber/go-batchify
 
-go 1.18
+go 1.21
 
 require (
 	github.com/samber/lo v1.53.0
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/samber/go-batchify/pkg/hasher"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 )
@@ -38,6 +39,14 @@ func mockDoKo(keys []string) (map[string]string, error) {
 	}), assert.AnError
 }
 
-func mockHasher(key string) uint64 {
+var mockHasher = hasher.Hasher[string](func(key string) uint64 {
 	return uint64(len(key))
+})
+
+// enqueue adds an input to the current buffer, like Do() without waiting for the result.
+// The returned buffer is retained.
+func (b *batchImpl[I, K, O]) enqueue(input I, key K, priority Priority) *buffer[I, K, O] {
+	currentBuffer, full := b.insert(input, key)
+	b.schedule(currentBuffer, priority, full)
+	return currentBuffer
 }
@@ -0,0 +1,44 @@
+package batchify
+
+import (
+	"context"
+	"time"
+)
+
+// BatchInfo describes a batch being dispatched. It is passed to callbacks through their context.
+// See InfoFromContext.
+type BatchInfo struct {
+	Name   string // see BatchConfig.WithName
+	Shard  int
+	Reason FlushReason
+	Size   int       // number of deduplicated inputs
+	Time   time.Time // dispatch time
+}
+
+type infoKey struct{}
+
+// infoContext carries the BatchInfo of a callback. Unlike context.WithValue, it does not box the
+// BatchInfo on every dispatch, but only when the callback reads it.
+type infoContext struct {
+	context.Context
+	info BatchInfo
+}
+
+func withInfo(ctx context.Context, info BatchInfo) *infoContext {
+	return &infoContext{Context: ctx, info: info}
+}
+
+func (c *infoContext) Value(key any) any {
+	if _, ok := key.(infoKey); ok {
+		return c.info
+	}
+
+	return c.Context.Value(key)
+}
+
+// InfoFromContext returns the description of the batch being dispatched, from the context
+// of a callback. See NewBatchConfigWithContext.
+func InfoFromContext(ctx context.Context) (BatchInfo, bool) {
+	info, ok := ctx.Value(infoKey{}).(BatchInfo)
+	return info, ok
+}
@@ -0,0 +1,21 @@
+package batchify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfoFromContext(t *testing.T) {
+	is := assert.New(t)
+
+	_, ok := InfoFromContext(context.Background())
+	is.False(ok)
+
+	info := BatchInfo{Shard: 2, Reason: FlushReasonTimer, Size: 10, Time: time.Now()}
+	got, ok := InfoFromContext(withInfo(context.Background(), info))
+	is.True(ok)
+	is.Equal(info, got)
+}
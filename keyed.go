@@ -0,0 +1,188 @@
+package batchify
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/samber/go-batchify/pkg/hasher"
+	"github.com/samber/lo"
+)
+
+// NewBatchConfigWithKey is a builder for Batch, for inputs that are not comparable (eg: structs holding
+// slices or maps). Inputs are deduplicated by the key returned by `key`, and `do` must index its results by that key.
+func NewBatchConfigWithKey[I any, K comparable, O any](bufferSize int, key func(I) K, do func([]I) (map[K]O, error)) KeyedBatchConfig[I, K, O] {
+	assertValue(bufferSize >= 1, "buffer size must be a positive value")
+	assertValue(key != nil, "key function must not be nil")
+
+	return KeyedBatchConfig[I, K, O]{
+		commonConfig: commonConfig[I, K, O]{
+			bufferSize: bufferSize,
+		},
+		key: key,
+		do: func(_ context.Context, inputs []I) (map[K]O, error) {
+			return do(inputs)
+		},
+	}
+}
+
+// KeyedBatchConfig is a builder for Batch, for inputs deduplicated by a key. See NewBatchConfigWithKey.
+// Its options behave like the options of BatchConfig.
+type KeyedBatchConfig[I any, K comparable, O any] struct {
+	commonConfig[I, K, O]
+
+	key func(I) K
+	do  KeyedDoFunc[I, K, O]
+
+	// applied around the callback, the first one being the outermost
+	middlewares []KeyedMiddleware[I, K, O]
+}
+
+// WithName: see BatchConfig.WithName.
+func (cfg KeyedBatchConfig[I, K, O]) WithName(name string) KeyedBatchConfig[I, K, O] {
+	assertValue(name != "", "name must not be empty")
+
+	cfg.name = name
+	return cfg
+}
+
+// WithTimer: see BatchConfig.WithTimer.
+func (cfg KeyedBatchConfig[I, K, O]) WithTimer(ttl time.Duration) KeyedBatchConfig[I, K, O] {
+	assertValue(ttl >= 0, "ttl must be a positive value")
+
+	cfg.ttl = ttl
+	return cfg
+}
+
+// WithLowPriorityTimer: see BatchConfig.WithLowPriorityTimer.
+func (cfg KeyedBatchConfig[I, K, O]) WithLowPriorityTimer(ttl time.Duration) KeyedBatchConfig[I, K, O] {
+	assertValue(ttl >= 0, "ttl must be a positive value")
+
+	cfg.lowPriorityTTL = ttl
+	return cfg
+}
+
+// WithSort: see BatchConfig.WithSort.
+func (cfg KeyedBatchConfig[I, K, O]) WithSort(less func(a, b I) bool) KeyedBatchConfig[I, K, O] {
+	assertValue(less != nil, "comparator must not be nil")
+
+	cfg.less = less
+	return cfg
+}
+
+// WithAutoStriping: see BatchConfig.WithAutoStriping.
+func (cfg KeyedBatchConfig[I, K, O]) WithAutoStriping() KeyedBatchConfig[I, K, O] {
+	cfg.partitioned = true
+	return cfg
+}
+
+// WithBufferPooling: see BatchConfig.WithBufferPooling.
+func (cfg KeyedBatchConfig[I, K, O]) WithBufferPooling() KeyedBatchConfig[I, K, O] {
+	cfg.pooling = true
+	return cfg
+}
+
+// WithLogger: see BatchConfig.WithLogger.
+func (cfg KeyedBatchConfig[I, K, O]) WithLogger(logger *slog.Logger) KeyedBatchConfig[I, K, O] {
+	assertValue(logger != nil, "logger must not be nil")
+
+	cfg.logger = logger
+	return cfg
+}
+
+// WithSlowCallbackThreshold: see BatchConfig.WithSlowCallbackThreshold.
+func (cfg KeyedBatchConfig[I, K, O]) WithSlowCallbackThreshold(threshold time.Duration) KeyedBatchConfig[I, K, O] {
+	assertValue(threshold >= 0, "threshold must be a positive value")
+
+	cfg.slowThreshold = threshold
+	return cfg
+}
+
+// WithClock: see BatchConfig.WithClock.
+func (cfg KeyedBatchConfig[I, K, O]) WithClock(clock Clock) KeyedBatchConfig[I, K, O] {
+	assertValue(clock != nil, "clock must not be nil")
+
+	cfg.clock = clock
+	return cfg
+}
+
+// WithMiddleware wraps the callback with middlewares. The first middleware is the outermost one.
+// The middlewares of the pkg/middleware package require comparable inputs: see BatchConfig.WithMiddleware.
+func (cfg KeyedBatchConfig[I, K, O]) WithMiddleware(middlewares ...KeyedMiddleware[I, K, O]) KeyedBatchConfig[I, K, O] {
+	for _, middleware := range middlewares {
+		assertValue(middleware != nil, "middleware must not be nil")
+	}
+
+	cfg.middlewares = append(append([]KeyedMiddleware[I, K, O]{}, cfg.middlewares...), middlewares...)
+	return cfg
+}
+
+// WithExecutor: see BatchConfig.WithExecutor.
+func (cfg KeyedBatchConfig[I, K, O]) WithExecutor(executor Executor) KeyedBatchConfig[I, K, O] {
+	assertValue(executor != nil, "executor must not be nil")
+
+	cfg.executor = executor
+	return cfg
+}
+
+// WithIdleDispatch: see BatchConfig.WithIdleDispatch.
+func (cfg KeyedBatchConfig[I, K, O]) WithIdleDispatch() KeyedBatchConfig[I, K, O] {
+	cfg.idleDispatch = true
+	return cfg
+}
+
+// WithPauseLimit: see BatchConfig.WithPauseLimit.
+func (cfg KeyedBatchConfig[I, K, O]) WithPauseLimit(waiters int) KeyedBatchConfig[I, K, O] {
+	assertValue(waiters >= 1, "waiters must be a positive value")
+
+	cfg.pauseLimit = waiters
+	return cfg
+}
+
+// WithSharding: see BatchConfig.WithSharding. The hasher receives inputs, not keys.
+func (cfg KeyedBatchConfig[I, K, O]) WithSharding(nbr int, fn hasher.Hasher[I]) KeyedBatchConfig[I, K, O] {
+	assertValue(nbr > 1, "shards must be greater than 1")
+	assertValue(fn != nil, "hasher must be greater not nil")
+
+	cfg.shards = nbr
+	cfg.shardingFn = fn
+	return cfg
+}
+
+// WithShardingStrategy: see BatchConfig.WithShardingStrategy.
+func (cfg KeyedBatchConfig[I, K, O]) WithShardingStrategy(nbr int, strategy hasher.Strategy[I]) KeyedBatchConfig[I, K, O] {
+	assertValue(nbr > 1, "shards must be greater than 1")
+	assertValue(strategy != nil, "sharding strategy must not be nil")
+
+	cfg.shards = nbr
+	cfg.shardingFn = strategy
+	return cfg
+}
+
+// WithShardBufferSize: see BatchConfig.WithShardBufferSize.
+func (cfg KeyedBatchConfig[I, K, O]) WithShardBufferSize(shard int, bufferSize int) KeyedBatchConfig[I, K, O] {
+	assertValue(shard >= 0, "shard must be a positive value")
+	assertValue(bufferSize >= 1, "buffer size must be a positive value")
+
+	cfg.shardBufferSizes = lo.Assign(cfg.shardBufferSizes, map[int]int{shard: bufferSize})
+	return cfg
+}
+
+// WithShardTimer: see BatchConfig.WithShardTimer.
+func (cfg KeyedBatchConfig[I, K, O]) WithShardTimer(shard int, ttl time.Duration) KeyedBatchConfig[I, K, O] {
+	assertValue(shard >= 0, "shard must be a positive value")
+	assertValue(ttl >= 0, "ttl must be a positive value")
+
+	cfg.shardTTLs = lo.Assign(cfg.shardTTLs, map[int]time.Duration{shard: ttl})
+	return cfg
+}
+
+// Build creates a new Batch instance.
+func (cfg KeyedBatchConfig[I, K, O]) Build() Batch[I, O] {
+	do := cfg.do
+	for i := len(cfg.middlewares) - 1; i >= 0; i-- {
+		do = cfg.middlewares[i](do)
+	}
+
+	return cfg.build(cfg.key, do)
+}
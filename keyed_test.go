@@ -0,0 +1,141 @@
+package batchify
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samber/go-batchify/pkg/hasher"
+	"github.com/stretchr/testify/assert"
+)
+
+type keyedQuery struct {
+	id      int
+	filters []string
+}
+
+func keyedQueryID(q keyedQuery) int {
+	return q.id
+}
+
+func keyedDo(queries []keyedQuery) (map[int]string, error) {
+	results := make(map[int]string, len(queries))
+	for _, q := range queries {
+		results[q.id] = strings.Join(q.filters, ",")
+	}
+	return results, nil
+}
+
+func TestNewBatchConfigWithKey(t *testing.T) {
+	is := assert.New(t)
+
+	cfg := NewBatchConfigWithKey(42, keyedQueryID, keyedDo).
+		WithName("queries").
+		WithTimer(time.Second).
+		WithLowPriorityTimer(2 * time.Second).
+		WithBufferPooling().
+		WithIdleDispatch().
+		WithPauseLimit(10)
+	is.Equal(42, cfg.bufferSize)
+	is.Equal("queries", cfg.name)
+	is.True(cfg.pooling)
+	is.True(cfg.idleDispatch)
+	is.Equal(10, cfg.pauseLimit)
+
+	batch := cfg.Build()
+	defer batch.Stop()
+
+	b, ok := batch.(*batchImpl[keyedQuery, int, string])
+	is.True(ok)
+	is.Equal("queries", b.name)
+	is.Equal(time.Second, b.ttl)
+	is.Equal(2*time.Second, b.lowPriorityTTL)
+	is.True(b.pooling)
+	is.True(b.idleDispatch)
+	is.Equal(10, b.pauseLimit)
+
+	result, err := batch.DoWithPriority(keyedQuery{id: 1, filters: []string{"a", "b"}}, PriorityHigh)
+	is.Nil(err)
+	is.Equal("a,b", result)
+
+	is.Panics(func() {
+		_ = NewBatchConfigWithKey[keyedQuery, int, string](0, keyedQueryID, keyedDo)
+	})
+	is.Panics(func() {
+		_ = NewBatchConfigWithKey[keyedQuery, int, string](42, nil, keyedDo)
+	})
+}
+
+func TestKeyedBatchConfig_WithMiddleware(t *testing.T) {
+	is := assert.New(t)
+
+	var mu sync.Mutex
+	calls := []string{}
+
+	trace := func(name string) KeyedMiddleware[keyedQuery, int, string] {
+		return func(next KeyedDoFunc[keyedQuery, int, string]) KeyedDoFunc[keyedQuery, int, string] {
+			return func(ctx context.Context, inputs []keyedQuery) (map[int]string, error) {
+				info, ok := InfoFromContext(ctx)
+				is.True(ok)
+				is.Equal(FlushReasonPriority, info.Reason)
+
+				mu.Lock()
+				calls = append(calls, name)
+				mu.Unlock()
+				return next(ctx, inputs)
+			}
+		}
+	}
+
+	cfg := NewBatchConfigWithKey(42, keyedQueryID, keyedDo).
+		WithMiddleware(trace("a"), trace("b"))
+	cfg2 := cfg.WithMiddleware(trace("c"))
+	is.Len(cfg.middlewares, 2)
+	is.Len(cfg2.middlewares, 3)
+
+	batch := cfg2.Build()
+	defer batch.Stop()
+
+	result, err := batch.DoWithPriority(keyedQuery{id: 1, filters: []string{"a"}}, PriorityHigh)
+	is.Nil(err)
+	is.Equal("a", result)
+	is.Equal([]string{"a", "b", "c"}, calls)
+
+	is.Panics(func() {
+		_ = cfg.WithMiddleware(nil)
+	})
+}
+
+func TestKeyedBatchConfig_WithSharding(t *testing.T) {
+	is := assert.New(t)
+
+	byID := hasher.Hasher[keyedQuery](func(q keyedQuery) uint64 {
+		return uint64(q.id)
+	})
+
+	batch := NewBatchConfigWithKey(42, keyedQueryID, keyedDo).
+		WithSharding(3, byID).
+		WithShardBufferSize(1, 10).
+		Build()
+	defer batch.Stop()
+
+	b, ok := batch.(*shardedBatchImpl[keyedQuery, string])
+	is.True(ok)
+	is.Len(b.routes().batches, 3)
+	is.Equal(42, b.routes().batches[0].(*batchImpl[keyedQuery, int, string]).bufferSize)
+	is.Equal(10, b.routes().batches[1].(*batchImpl[keyedQuery, int, string]).bufferSize)
+
+	result, err := batch.DoWithPriority(keyedQuery{id: 4, filters: []string{"a", "b"}}, PriorityHigh)
+	is.Nil(err)
+	is.Equal("a,b", result)
+	is.Equal(uint64(1), b.routes().batches[1].Stats().Flushes[FlushReasonPriority])
+
+	is.Panics(func() {
+		_ = NewBatchConfigWithKey(42, keyedQueryID, keyedDo).
+			WithShardTimer(3, time.Second).
+			WithSharding(3, byID).
+			Build()
+	})
+}
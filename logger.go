@@ -0,0 +1,59 @@
+package batchify
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+)
+
+// call runs the callback, and logs its outcome when a logger is configured.
+func (b *batchImpl[I, K, O]) call(ctx context.Context, inputs []I) (map[K]O, error) {
+	if b.logger == nil {
+		return b.do(ctx, inputs)
+	}
+
+	return b.callWithLogs(ctx, inputs)
+}
+
+// callWithLogs is split from call(), so that the callback goroutine does not grow its stack
+// for the log attributes when logging is disabled.
+func (b *batchImpl[I, K, O]) callWithLogs(ctx context.Context, inputs []I) (map[K]O, error) {
+	info, _ := InfoFromContext(ctx)
+	attrs := []slog.Attr{
+		slog.Int("size", len(inputs)),
+		slog.String("reason", string(info.Reason)),
+		slog.Int("shard", b.shard),
+	}
+	if b.name != "" {
+		attrs = append(attrs, slog.String("batcher", b.name))
+	}
+
+	b.logger.LogAttrs(ctx, slog.LevelDebug, "batchify: dispatching batch", attrs...)
+
+	start := b.clock.Now()
+
+	defer func() {
+		// the panic is logged, then propagated as if no logger was configured
+		if r := recover(); r != nil {
+			b.logger.LogAttrs(ctx, slog.LevelError, "batchify: callback panicked", append(attrs, slog.Duration("duration", since(b.clock, start)), slog.Any("panic", r), slog.String("stack", string(debug.Stack())))...)
+			panic(r)
+		}
+	}()
+
+	values, err := b.do(ctx, inputs)
+
+	duration := since(b.clock, start)
+	attrs = append(attrs, slog.Duration("duration", duration))
+
+	if err != nil {
+		b.logger.LogAttrs(ctx, slog.LevelError, "batchify: callback failed", append(attrs, slog.Any("error", err))...)
+	} else {
+		b.logger.LogAttrs(ctx, slog.LevelDebug, "batchify: batch completed", attrs...)
+	}
+
+	if b.slowThreshold > 0 && duration >= b.slowThreshold {
+		b.logger.LogAttrs(ctx, slog.LevelWarn, "batchify: slow callback", append(attrs, slog.Duration("threshold", b.slowThreshold))...)
+	}
+
+	return values, err
+}
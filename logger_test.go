@@ -0,0 +1,153 @@
+package batchify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLogger() (*slog.Logger, *bytes.Buffer) {
+	var output bytes.Buffer
+	return slog.New(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug})), &output
+}
+
+func parseLogs(t *testing.T, output *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	logs := []map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var log map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &log))
+		logs = append(logs, log)
+	}
+
+	return logs
+}
+
+func TestBatchImpl_call_noLogger(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatch(42, 0, mockDoKo)
+	defer b.Stop()
+
+	values, err := b.call(withInfo(context.Background(), BatchInfo{Reason: FlushReasonManual}), []string{"a"})
+	is.ErrorIs(err, assert.AnError)
+	is.Equal(map[string]string{"a": "aa"}, values)
+}
+
+func TestBatchImpl_call_logger(t *testing.T) {
+	is := assert.New(t)
+
+	logger, output := newTestLogger()
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 2,
+		key:        identity[string],
+		do:         mockDoOk,
+		shard:      3,
+		name:       "users",
+		logger:     logger,
+	})
+	defer b.Stop()
+
+	result, err := b.DoWithPriority("a", PriorityHigh)
+	is.Nil(err)
+	is.Equal("aa", result)
+
+	logs := parseLogs(t, output)
+	is.Len(logs, 2)
+	is.Equal("DEBUG", logs[0]["level"])
+	is.Equal("batchify: dispatching batch", logs[0]["msg"])
+	is.EqualValues(1, logs[0]["size"])
+	is.Equal("priority", logs[0]["reason"])
+	is.EqualValues(3, logs[0]["shard"])
+	is.Equal("users", logs[0]["batcher"])
+	is.Equal("batchify: batch completed", logs[1]["msg"])
+	is.Contains(logs[1], "duration")
+}
+
+func TestBatchImpl_call_error(t *testing.T) {
+	is := assert.New(t)
+
+	logger, output := newTestLogger()
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 2,
+		key:        identity[string],
+		do:         mockDoKo,
+		logger:     logger,
+	})
+	defer b.Stop()
+
+	_, err := b.call(withInfo(context.Background(), BatchInfo{Reason: FlushReasonSize}), []string{"a", "b"})
+	is.ErrorIs(err, assert.AnError)
+
+	logs := parseLogs(t, output)
+	is.Len(logs, 2)
+	is.Equal("ERROR", logs[1]["level"])
+	is.Equal("batchify: callback failed", logs[1]["msg"])
+	is.Equal(assert.AnError.Error(), logs[1]["error"])
+	is.EqualValues(2, logs[1]["size"])
+	is.Equal("size", logs[1]["reason"])
+	is.NotContains(logs[1], "batcher")
+}
+
+func TestBatchImpl_call_slow(t *testing.T) {
+	is := assert.New(t)
+
+	logger, output := newTestLogger()
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 2,
+		key:        identity[string],
+		do: func(inputs []string) (map[string]string, error) {
+			time.Sleep(10 * time.Millisecond)
+			return mockDoOk(inputs)
+		},
+		logger:        logger,
+		slowThreshold: 5 * time.Millisecond,
+	})
+	defer b.Stop()
+
+	_, err := b.call(withInfo(context.Background(), BatchInfo{Reason: FlushReasonTimer}), []string{"a"})
+	is.Nil(err)
+
+	logs := parseLogs(t, output)
+	is.Len(logs, 3)
+	is.Equal("WARN", logs[2]["level"])
+	is.Equal("batchify: slow callback", logs[2]["msg"])
+	is.Contains(logs[2], "threshold")
+}
+
+func TestBatchImpl_call_panic(t *testing.T) {
+	is := assert.New(t)
+
+	logger, output := newTestLogger()
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 2,
+		key:        identity[string],
+		do: func(inputs []string) (map[string]string, error) {
+			panic("boom")
+		},
+		logger: logger,
+	})
+	defer b.Stop()
+
+	is.PanicsWithValue("boom", func() {
+		_, _ = b.call(withInfo(context.Background(), BatchInfo{Reason: FlushReasonManual}), []string{"a"})
+	})
+
+	logs := parseLogs(t, output)
+	is.Len(logs, 2)
+	is.Equal("ERROR", logs[1]["level"])
+	is.Equal("batchify: callback panicked", logs[1]["msg"])
+	is.Equal("boom", logs[1]["panic"])
+	is.Contains(logs[1]["stack"], "logger.go")
+}
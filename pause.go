@@ -0,0 +1,80 @@
+package batchify
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+)
+
+// ErrPaused is returned by a paused batch once too many callers are waiting. See BatchConfig.WithPauseLimit.
+var ErrPaused = errors.New("batch is paused")
+
+// Pause stops dispatching buffers, eg: during a database failover. Callers keep queuing inputs
+// and wait until Resume(). Buffers keep being sealed on size, timer or Flush(), and are held in order.
+func (b *batchImpl[I, K, O]) Pause() {
+	b.pauseMu.Lock()
+	if atomic.LoadInt32(&b.stopped) == 0 {
+		atomic.StoreInt32(&b.paused, 1)
+	}
+	b.pauseMu.Unlock()
+}
+
+// Resume dispatches the buffers held since Pause(), in order, through the executor.
+func (b *batchImpl[I, K, O]) Resume() {
+	b.pauseMu.Lock()
+	atomic.StoreInt32(&b.paused, 0)
+	held := b.held
+	b.held = nil
+	b.pauseMu.Unlock()
+
+	// buffers may have been held in a different order than they were sealed
+	sort.Slice(held, func(i, j int) bool {
+		return held[i].seq < held[j].seq
+	})
+
+	for _, buffer := range held {
+		b.execute(buffer)
+	}
+}
+
+// hold keeps `buffer` until Resume(), when the batch is paused.
+func (b *batchImpl[I, K, O]) hold(buffer *buffer[I, K, O]) bool {
+	if atomic.LoadInt32(&b.paused) == 0 {
+		return false
+	}
+
+	b.pauseMu.Lock()
+	defer b.pauseMu.Unlock()
+
+	// resumed in the meantime
+	if atomic.LoadInt32(&b.paused) == 0 {
+		return false
+	}
+
+	b.held = append(b.held, buffer)
+	return true
+}
+
+// admit counts the waiting callers, and rejects them once the limit is reached while paused.
+// Admitted callers must call leave() when they stop waiting.
+func (b *batchImpl[I, K, O]) admit() error {
+	if b.pauseLimit == 0 {
+		return nil
+	}
+
+	waiting := atomic.AddInt64(&b.counters.waiting, 1)
+	if waiting > int64(b.pauseLimit) && atomic.LoadInt32(&b.paused) == 1 {
+		atomic.AddInt64(&b.counters.waiting, -1)
+		return ErrPaused
+	}
+
+	return nil
+}
+
+// leave uncounts a caller accepted by admit(). It is a method, not a closure returned by admit(),
+// so that Do() does not allocate.
+func (b *batchImpl[I, K, O]) leave() {
+	if b.pauseLimit > 0 {
+		atomic.AddInt64(&b.counters.waiting, -1)
+	}
+}
@@ -0,0 +1,125 @@
+package batchify
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchImpl_Pause(t *testing.T) {
+	is := assert.New(t)
+
+	var mu sync.Mutex
+	calls := [][]string{}
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 2,
+		key:        identity[string],
+		executor:   InlineExecutor{},
+		do: func(inputs []string) (map[string]string, error) {
+			mu.Lock()
+			calls = append(calls, append([]string{}, inputs...))
+			mu.Unlock()
+			return mockDoOk(inputs)
+		},
+	})
+	defer b.Stop()
+
+	b.Pause()
+
+	var wg sync.WaitGroup
+	for _, input := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(input string) {
+			defer wg.Done()
+			result, err := b.Do(input)
+			is.Nil(err)
+			is.Equal(input+input, result)
+		}(input)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 2 buffers sealed: full, then manual flush
+	b.Flush()
+	time.Sleep(5 * time.Millisecond)
+	mu.Lock()
+	is.Empty(calls)
+	mu.Unlock()
+	is.Len(b.held, 2)
+
+	b.Resume()
+	wg.Wait()
+
+	mu.Lock()
+	is.Equal([][]string{{"a", "b"}, {"c"}}, calls)
+	mu.Unlock()
+	is.Empty(b.held)
+	is.EqualValues(1, b.Stats().Flushes[FlushReasonSize])
+	is.EqualValues(1, b.Stats().Flushes[FlushReasonManual])
+}
+
+func TestBatchImpl_Pause_limit(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 10,
+		key:        identity[string],
+		do:         mockDoOk,
+		pauseLimit: 1,
+	})
+	defer b.Stop()
+
+	b.Pause()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, err := b.DoWithPriority("a", PriorityHigh)
+		is.Nil(err)
+		is.Equal("aa", result)
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	_, err := b.Do("b")
+	is.ErrorIs(err, ErrPaused)
+
+	// rejected before waiting, whatever the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = b.DoWithContext(ctx, "c")
+	is.ErrorIs(err, ErrPaused)
+
+	b.Resume()
+	<-done
+
+	result, err := b.DoWithPriority("b", PriorityHigh)
+	is.Nil(err)
+	is.Equal("bb", result)
+}
+
+func TestBatchImpl_Pause_stop(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatch(10, 0, mockDoOk)
+	b.Pause()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, err := b.DoWithPriority("a", PriorityHigh)
+		is.Nil(err)
+		is.Equal("aa", result)
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	// Stop() resumes the batch, to drain the pending inputs
+	b.Stop()
+	<-done
+	is.EqualValues(0, b.paused)
+
+	// no-op once stopped
+	b.Pause()
+	is.EqualValues(0, b.paused)
+}
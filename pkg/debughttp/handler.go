@@ -0,0 +1,242 @@
+package debughttp
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samber/go-batchify"
+)
+
+// Handler serves DefaultRegistry. It must be mounted on a path ending with a slash:
+//
+//	mux.Handle("/debug/batchify/", debughttp.Handler())
+//
+// Routes, relative to the mount path:
+//
+//	GET  /                 HTML page
+//	GET  /json[?name=...]  JSON list of batchers, or a single batcher
+//	POST /flush?name=...   calls Flush() on a batcher
+func Handler() http.Handler {
+	return DefaultRegistry
+}
+
+// ServeHTTP implements http.Handler. See Handler().
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:] {
+	case "json":
+		r.serveJSON(w, req)
+	case "flush":
+		r.serveFlush(w, req)
+	default:
+		r.serveHTML(w, req)
+	}
+}
+
+func (r *Registry) serveJSON(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload any
+	if name := req.URL.Query().Get("name"); name != "" {
+		batcher, ok := r.get(name)
+		if !ok {
+			http.Error(w, "batcher not found", http.StatusNotFound)
+			return
+		}
+
+		payload = newBatcherView(name, batcher)
+	} else {
+		payload = r.views()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func (r *Registry) serveFlush(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	batcher, ok := r.get(req.FormValue("name"))
+	if !ok {
+		http.Error(w, "batcher not found", http.StatusNotFound)
+		return
+	}
+
+	batcher.Flush()
+
+	// back to the HTML page, when submitted from a browser
+	if strings.Contains(req.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, req, "./", http.StatusSeeOther)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *Registry) serveHTML(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = page.Execute(w, r.views())
+}
+
+func (r *Registry) views() []batcherView {
+	names := r.names()
+
+	views := make([]batcherView, 0, len(names))
+	for _, name := range names {
+		// might have been unregistered in the meantime
+		if batcher, ok := r.get(name); ok {
+			views = append(views, newBatcherView(name, batcher))
+		}
+	}
+
+	return views
+}
+
+type batcherView struct {
+	Name      string                          `json:"name"`
+	Settings  *settingsView                   `json:"settings,omitempty"`
+	Pending   int                             `json:"pending"`
+	InFlight  int                             `json:"in_flight"`
+	Flushes   map[batchify.FlushReason]uint64 `json:"flushes"`
+	Inputs    uint64                          `json:"inputs"`
+	DedupHits uint64                          `json:"dedup_hits"`
+	Errors    uint64                          `json:"errors"`
+	LastFlush *time.Time                      `json:"last_flush,omitempty"`
+	History   []flushView                     `json:"history"`
+}
+
+type settingsView struct {
+	BufferSize     int            `json:"buffer_size"`
+	TTL            string         `json:"ttl"`
+	LowPriorityTTL string         `json:"low_priority_ttl"`
+	Shards         []settingsView `json:"shards,omitempty"`
+}
+
+type flushView struct {
+	Shard    int       `json:"shard"`
+	Reason   string    `json:"reason"`
+	Size     int       `json:"size"`
+	Time     time.Time `json:"time"`
+	Duration string    `json:"duration"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func newBatcherView(name string, batcher Batcher) batcherView {
+	stats := batcher.Stats()
+
+	view := batcherView{
+		Name:      name,
+		Settings:  nil,
+		Pending:   stats.Pending,
+		InFlight:  stats.InFlight,
+		Flushes:   stats.Flushes,
+		Inputs:    stats.Inputs,
+		DedupHits: stats.DedupHits,
+		Errors:    stats.Errors,
+		LastFlush: nil,
+		History:   make([]flushView, 0, len(stats.History)),
+	}
+
+	if provider, ok := batcher.(interface{ Settings() batchify.Settings }); ok {
+		settings := newSettingsView(provider.Settings())
+		view.Settings = &settings
+	}
+
+	if !stats.LastFlush.IsZero() {
+		view.LastFlush = &stats.LastFlush
+	}
+
+	for _, event := range stats.History {
+		flush := flushView{
+			Shard:    event.Shard,
+			Reason:   string(event.Reason),
+			Size:     event.Size,
+			Time:     event.Time,
+			Duration: event.Duration.String(),
+			Error:    "",
+		}
+		if event.Err != nil {
+			flush.Error = event.Err.Error()
+		}
+
+		view.History = append(view.History, flush)
+	}
+
+	return view
+}
+
+func newSettingsView(settings batchify.Settings) settingsView {
+	view := settingsView{
+		BufferSize:     settings.BufferSize,
+		TTL:            settings.TTL.String(),
+		LowPriorityTTL: settings.LowPriorityTTL.String(),
+		Shards:         nil,
+	}
+
+	for _, shard := range settings.Shards {
+		view.Shards = append(view.Shards, newSettingsView(shard))
+	}
+
+	return view
+}
+
+var page = template.Must(template.New("batchify").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>batchify</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>batchify</h1>
+<p><a href="json">json</a></p>
+{{range .}}
+<h2>{{.Name}}</h2>
+<form method="post" action="flush"><input type="hidden" name="name" value="{{.Name}}"><button type="submit">Flush</button></form>
+<table>
+{{with .Settings}}
+<tr><th>buffer size</th><td>{{.BufferSize}}</td></tr>
+<tr><th>ttl</th><td>{{.TTL}}</td></tr>
+<tr><th>low-priority ttl</th><td>{{.LowPriorityTTL}}</td></tr>
+{{if .Shards}}<tr><th>shards</th><td>{{len .Shards}}</td></tr>{{end}}
+{{end}}
+<tr><th>pending</th><td>{{.Pending}}</td></tr>
+<tr><th>in flight</th><td>{{.InFlight}}</td></tr>
+<tr><th>inputs</th><td>{{.Inputs}}</td></tr>
+<tr><th>dedup hits</th><td>{{.DedupHits}}</td></tr>
+<tr><th>errors</th><td>{{.Errors}}</td></tr>
+<tr><th>flushes</th><td>{{range $reason, $count := .Flushes}}{{$reason}}: {{$count}} {{end}}</td></tr>
+<tr><th>last flush</th><td>{{with .LastFlush}}{{.}}{{else}}-{{end}}</td></tr>
+</table>
+{{if .History}}
+<table>
+<tr><th>time</th><th>shard</th><th>reason</th><th>size</th><th>duration</th><th>error</th></tr>
+{{range .History}}<tr><td>{{.Time}}</td><td>{{.Shard}}</td><td>{{.Reason}}</td><td>{{.Size}}</td><td>{{.Duration}}</td><td>{{.Error}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{else}}
+<p>No batcher registered.</p>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,138 @@
+package debughttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samber/go-batchify"
+	"github.com/samber/go-batchify/pkg/hasher"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRegistry(t *testing.T) (*Registry, batchify.Batch[string, int]) {
+	t.Helper()
+
+	users := batchify.NewBatchWithTimer(10, mockDo, time.Hour)
+	orders := batchify.NewShardedBatch(2, hasher.FNV1aString, 10, mockDo)
+	t.Cleanup(users.Stop)
+	t.Cleanup(orders.Stop)
+
+	r := NewRegistry()
+	r.Register("users", users)
+	r.Register("orders", orders)
+
+	return r, users
+}
+
+func serve(r *Registry, method string, target string, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRegistry_ServeHTTP_json(t *testing.T) {
+	is := assert.New(t)
+
+	r, users := newTestRegistry(t)
+
+	result, err := users.DoWithPriority("abc", batchify.PriorityHigh)
+	is.Nil(err)
+	is.Equal(3, result)
+
+	w := serve(r, http.MethodGet, "/debug/batchify/json", "")
+	is.Equal(http.StatusOK, w.Code)
+	is.Equal("application/json", w.Header().Get("Content-Type"))
+
+	var views []batcherView
+	is.NoError(json.Unmarshal(w.Body.Bytes(), &views))
+	is.Len(views, 2)
+	is.Equal("orders", views[0].Name)
+	is.Len(views[0].Settings.Shards, 2)
+	is.Nil(views[0].LastFlush)
+	is.Equal("users", views[1].Name)
+	is.Equal(10, views[1].Settings.BufferSize)
+	is.Equal("1h0m0s", views[1].Settings.TTL)
+	is.Empty(views[1].Settings.Shards)
+
+	w = serve(r, http.MethodGet, "/debug/batchify/json?name=users", "")
+	is.Equal(http.StatusOK, w.Code)
+
+	var view batcherView
+	is.NoError(json.Unmarshal(w.Body.Bytes(), &view))
+	is.Equal("users", view.Name)
+	is.EqualValues(1, view.Inputs)
+	is.NotNil(view.LastFlush)
+	is.Len(view.History, 1)
+	is.Equal("priority", view.History[0].Reason)
+
+	w = serve(r, http.MethodGet, "/debug/batchify/json?name=unknown", "")
+	is.Equal(http.StatusNotFound, w.Code)
+
+	w = serve(r, http.MethodPost, "/debug/batchify/json", "")
+	is.Equal(http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestRegistry_ServeHTTP_flush(t *testing.T) {
+	is := assert.New(t)
+
+	r, users := newTestRegistry(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = users.Do("abcd")
+	}()
+
+	is.Eventually(func() bool {
+		return users.Stats().Pending == 1
+	}, time.Second, time.Millisecond)
+
+	w := serve(r, http.MethodPost, "/debug/batchify/flush?name=users", "")
+	is.Equal(http.StatusNoContent, w.Code)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		is.Fail("batch has not been flushed")
+	}
+	is.EqualValues(1, users.Stats().Flushes[batchify.FlushReasonManual])
+
+	w = serve(r, http.MethodPost, "/debug/batchify/flush?name=users", "text/html,application/xhtml+xml")
+	is.Equal(http.StatusSeeOther, w.Code)
+	is.Equal("/debug/batchify/", w.Header().Get("Location"))
+
+	w = serve(r, http.MethodPost, "/debug/batchify/flush?name=unknown", "")
+	is.Equal(http.StatusNotFound, w.Code)
+
+	w = serve(r, http.MethodGet, "/debug/batchify/flush?name=users", "")
+	is.Equal(http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestRegistry_ServeHTTP_html(t *testing.T) {
+	is := assert.New(t)
+
+	r, users := newTestRegistry(t)
+	_, _ = users.DoWithPriority("abc", batchify.PriorityHigh)
+
+	w := serve(r, http.MethodGet, "/debug/batchify/", "")
+	is.Equal(http.StatusOK, w.Code)
+	is.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	is.Contains(w.Body.String(), "<h2>orders</h2>")
+	is.Contains(w.Body.String(), "<h2>users</h2>")
+	is.Contains(w.Body.String(), `action="flush"`)
+	is.Contains(w.Body.String(), "<td>priority</td>")
+
+	w = serve(NewRegistry(), http.MethodGet, "/debug/batchify/", "")
+	is.Contains(w.Body.String(), "No batcher registered.")
+
+	w = serve(r, http.MethodDelete, "/debug/batchify/", "")
+	is.Equal(http.StatusMethodNotAllowed, w.Code)
+}
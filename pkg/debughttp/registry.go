@@ -0,0 +1,92 @@
+package debughttp
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/samber/go-batchify"
+)
+
+// Batcher is implemented by every batchify.Batch. When the batcher also implements
+// `interface{ Settings() batchify.Settings }`, its configuration is displayed.
+type Batcher interface {
+	Flush()
+	Stats() batchify.Stats
+}
+
+var _ Batcher = (batchify.Batch[string, int])(nil)
+
+// DefaultRegistry is served by Handler().
+var DefaultRegistry = NewRegistry()
+
+// Register adds a batcher to DefaultRegistry.
+func Register(name string, batcher Batcher) {
+	DefaultRegistry.Register(name, batcher)
+}
+
+// Unregister removes a batcher from DefaultRegistry.
+func Unregister(name string) {
+	DefaultRegistry.Unregister(name)
+}
+
+// NewRegistry creates an empty registry of batchers, indexed by name.
+func NewRegistry() *Registry {
+	return &Registry{
+		mu:       sync.RWMutex{},
+		batchers: map[string]Batcher{},
+	}
+}
+
+// Registry is a set of named batchers. It is an http.Handler.
+type Registry struct {
+	mu       sync.RWMutex
+	batchers map[string]Batcher
+}
+
+// Register adds a batcher. It panics if the name is already used.
+func (r *Registry) Register(name string, batcher Batcher) {
+	if name == "" {
+		panic("batcher name must not be empty")
+	}
+	if batcher == nil {
+		panic("batcher must not be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.batchers[name]; ok {
+		panic("batcher already registered: " + name)
+	}
+
+	r.batchers[name] = batcher
+}
+
+// Unregister removes a batcher, typically after Stop().
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	delete(r.batchers, name)
+	r.mu.Unlock()
+}
+
+func (r *Registry) get(name string) (Batcher, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	batcher, ok := r.batchers[name]
+	return batcher, ok
+}
+
+// names returns the registered names, in alphabetical order.
+func (r *Registry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.batchers))
+	for name := range r.batchers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
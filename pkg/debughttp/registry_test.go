@@ -0,0 +1,67 @@
+package debughttp
+
+import (
+	"testing"
+
+	"github.com/samber/go-batchify"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockDo(keys []string) (map[string]int, error) {
+	out := map[string]int{}
+	for _, key := range keys {
+		out[key] = len(key)
+	}
+	return out, nil
+}
+
+func TestRegistry(t *testing.T) {
+	is := assert.New(t)
+
+	r := NewRegistry()
+	is.Empty(r.names())
+
+	b1 := batchify.NewBatch(10, mockDo)
+	b2 := batchify.NewBatch(10, mockDo)
+	defer b1.Stop()
+	defer b2.Stop()
+
+	r.Register("users", b1)
+	r.Register("orders", b2)
+	is.Equal([]string{"orders", "users"}, r.names())
+
+	batcher, ok := r.get("users")
+	is.True(ok)
+	is.Equal(b1, batcher)
+
+	is.Panics(func() {
+		r.Register("users", b2)
+	})
+	is.Panics(func() {
+		r.Register("", b2)
+	})
+	is.Panics(func() {
+		r.Register("products", nil)
+	})
+
+	r.Unregister("users")
+	r.Unregister("unknown")
+	is.Equal([]string{"orders"}, r.names())
+
+	_, ok = r.get("users")
+	is.False(ok)
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	is := assert.New(t)
+
+	b := batchify.NewBatch(10, mockDo)
+	defer b.Stop()
+
+	Register("default", b)
+	is.Equal([]string{"default"}, DefaultRegistry.names())
+	is.Equal(DefaultRegistry, Handler())
+
+	Unregister("default")
+	is.Empty(DefaultRegistry.names())
+}
@@ -0,0 +1,260 @@
+package hasher
+
+import (
+	"math"
+	"math/bits"
+	"reflect"
+	"unsafe"
+)
+
+// Integer is a constraint that permits any integer type.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+var _ Hasher[string] = FNV1aString
+var _ Hasher[[]byte] = FNV1aBytes
+var _ Hasher[string] = XXHashString
+var _ Hasher[[]byte] = XXHashBytes
+var _ Hasher[int] = Int[int]
+var _ Hasher[struct{}] = Comparable[struct{}]
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// FNV1aString is a Hasher implementing 64-bit FNV-1a. It is fast for short strings.
+func FNV1aString(key string) uint64 {
+	hash := uint64(fnvOffset64)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= fnvPrime64
+	}
+	return hash
+}
+
+// FNV1aBytes is a Hasher implementing 64-bit FNV-1a. It is fast for short byte slices.
+func FNV1aBytes(key []byte) uint64 {
+	hash := uint64(fnvOffset64)
+	for _, c := range key {
+		hash ^= uint64(c)
+		hash *= fnvPrime64
+	}
+	return hash
+}
+
+// XXHashString is a Hasher implementing XXH64 (seed 0). It is faster than FNV-1a for long strings.
+func XXHashString(key string) uint64 {
+	return xxh64(key)
+}
+
+// XXHashBytes is a Hasher implementing XXH64 (seed 0). It is faster than FNV-1a for long byte slices.
+func XXHashBytes(key []byte) uint64 {
+	return xxh64(key)
+}
+
+// Int is a Hasher for integer types. Bits are mixed, so that patterned ids (eg: multiples of the
+// number of shards) are spread evenly, unlike `uint64(key)`.
+func Int[K Integer](key K) uint64 {
+	return mix64(uint64(key))
+}
+
+// Comparable is a Hasher for any comparable type. Values are hashed the way `==` compares them:
+// pointers and channels by address, structs and arrays field by field, interfaces by dynamic value.
+// Basic types, including named ones (eg: `type UserID string`), and pointers are hashed without
+// allocation. Structs, arrays and interfaces are hashed with reflection, which is slower: prefer
+// a dedicated Hasher on hot paths.
+func Comparable[K comparable](key K) uint64 {
+	// the kind of named types is read from the static type, without boxing the key
+	p := unsafe.Pointer(&key)
+
+	switch reflect.TypeOf((*K)(nil)).Elem().Kind() {
+	case reflect.String:
+		return xxh64(*(*string)(p))
+	case reflect.Int:
+		return mix64(uint64(*(*int)(p)))
+	case reflect.Int8:
+		return mix64(uint64(*(*int8)(p)))
+	case reflect.Int16:
+		return mix64(uint64(*(*int16)(p)))
+	case reflect.Int32:
+		return mix64(uint64(*(*int32)(p)))
+	case reflect.Int64:
+		return mix64(uint64(*(*int64)(p)))
+	case reflect.Uint:
+		return mix64(uint64(*(*uint)(p)))
+	case reflect.Uint8:
+		return mix64(uint64(*(*uint8)(p)))
+	case reflect.Uint16:
+		return mix64(uint64(*(*uint16)(p)))
+	case reflect.Uint32:
+		return mix64(uint64(*(*uint32)(p)))
+	case reflect.Uint64:
+		return mix64(*(*uint64)(p))
+	case reflect.Uintptr, reflect.Pointer, reflect.UnsafePointer, reflect.Chan:
+		return mix64(uint64(*(*uintptr)(p)))
+	case reflect.Float32:
+		return hashFloat(float64(*(*float32)(p)))
+	case reflect.Float64:
+		return hashFloat(*(*float64)(p))
+	case reflect.Bool:
+		return hashBool(*(*bool)(p))
+	default:
+		return hashValue(reflect.ValueOf(key))
+	}
+}
+
+// hashValue hashes a comparable value, following its kind.
+func hashValue(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Invalid:
+		// nil interface
+		return 0
+	case reflect.String:
+		return xxh64(v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return mix64(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return mix64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return hashFloat(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return combine(hashFloat(real(c)), hashFloat(imag(c)))
+	case reflect.Bool:
+		return hashBool(v.Bool())
+	case reflect.Pointer, reflect.UnsafePointer, reflect.Chan:
+		return mix64(uint64(v.Pointer()))
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return hashValue(v.Elem())
+	case reflect.Struct:
+		hash := uint64(xxPrime5)
+		for i := 0; i < v.NumField(); i++ {
+			hash = combine(hash, hashValue(v.Field(i)))
+		}
+		return hash
+	case reflect.Array:
+		hash := uint64(xxPrime5)
+		for i := 0; i < v.Len(); i++ {
+			hash = combine(hash, hashValue(v.Index(i)))
+		}
+		return hash
+	default:
+		// not comparable: unreachable for a `comparable` key
+		panic("hasher: unsupported kind " + v.Kind().String())
+	}
+}
+
+// hashFloat hashes equal floats alike: +0 and -0 are equal.
+func hashFloat(f float64) uint64 {
+	if f == 0 {
+		return mix64(0)
+	}
+	return mix64(math.Float64bits(f))
+}
+
+func hashBool(b bool) uint64 {
+	if b {
+		return mix64(1)
+	}
+	return mix64(0)
+}
+
+func combine(hash uint64, value uint64) uint64 {
+	return mix64(bits.RotateLeft64(hash, 31) ^ value)
+}
+
+/**
+ * XXH64
+ * See https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+ */
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func xxh64[T ~string | ~[]byte](b T) uint64 {
+	n := len(b)
+	var h uint64
+
+	if n >= 32 {
+		p1, p2 := xxPrime1, xxPrime2 // not constants, so that additions wrap around
+
+		v1 := p1 + p2
+		v2 := p2
+		v3 := uint64(0)
+		v4 := -p1
+
+		for len(b) >= 32 {
+			v1 = xxRound(v1, readU64(b[0:8]))
+			v2 = xxRound(v2, readU64(b[8:16]))
+			v3 = xxRound(v3, readU64(b[16:24]))
+			v4 = xxRound(v4, readU64(b[24:32]))
+			b = b[32:]
+		}
+
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = xxPrime5
+	}
+
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, readU64(b[:8]))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(readU32(b[:4])) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for ; len(b) > 0; b = b[1:] {
+		h ^= uint64(b[0]) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	acc *= xxPrime1
+	return acc
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	val = xxRound(0, val)
+	acc ^= val
+	acc = acc*xxPrime1 + xxPrime4
+	return acc
+}
+
+func readU64[T ~string | ~[]byte](b T) uint64 {
+	return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+		uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56
+}
+
+func readU32[T ~string | ~[]byte](b T) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
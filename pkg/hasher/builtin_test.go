@@ -0,0 +1,204 @@
+package hasher
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertDistribution checks that keys are spread evenly across shards.
+func assertDistribution[K any](t *testing.T, fn Hasher[K], keys []K, shards uint64) {
+	t.Helper()
+	is := assert.New(t)
+
+	counts := make([]int, shards)
+	for _, key := range keys {
+		counts[fn.ComputeHash(key, shards)]++
+	}
+
+	expected := float64(len(keys)) / float64(shards)
+	for shard, count := range counts {
+		is.InEpsilonf(expected, float64(count), 0.1, "shard %d", shard)
+	}
+}
+
+func TestFNV1a(t *testing.T) {
+	is := assert.New(t)
+
+	is.Equal(uint64(0xcbf29ce484222325), FNV1aString(""))
+	is.Equal(uint64(0xaf63dc4c8601ec8c), FNV1aString("a"))
+	is.Equal(uint64(0xe71fa2190541574b), FNV1aString("abc"))
+	is.Equal(FNV1aString("hello world"), FNV1aBytes([]byte("hello world")))
+
+	keys := make([]string, 100_000)
+	for i := range keys {
+		keys[i] = "user:" + strconv.Itoa(i)
+	}
+	assertDistribution(t, FNV1aString, keys, 16)
+}
+
+func TestXXHash(t *testing.T) {
+	is := assert.New(t)
+
+	is.Equal(uint64(0xef46db3751d8e999), XXHashString(""))
+	is.Equal(uint64(0xd24ec4f1a98c6e5b), XXHashString("a"))
+	is.Equal(uint64(0x44bc2cf5ad770999), XXHashString("abc"))
+	is.Equal(uint64(0xfbcea83c8a378bf1), XXHashString("Nobody inspects the spammish repetition"))
+	is.Equal(XXHashString("Nobody inspects the spammish repetition"), XXHashBytes([]byte("Nobody inspects the spammish repetition")))
+
+	keys := make([][]byte, 100_000)
+	for i := range keys {
+		keys[i] = []byte("user:" + strconv.Itoa(i))
+	}
+	assertDistribution(t, XXHashBytes, keys, 16)
+}
+
+func TestInt(t *testing.T) {
+	is := assert.New(t)
+
+	is.NotEqual(Int(1), Int(2))
+	is.Equal(Int(42), Int(int64(42)))
+	is.Equal(Int(42), Int(uint8(42)))
+
+	// patterned ids: multiples of the number of shards
+	keys := make([]int, 100_000)
+	for i := range keys {
+		keys[i] = i * 16
+	}
+	assertDistribution(t, Int[int], keys, 16)
+	is.Equal(uint64(0), Hasher[int](func(key int) uint64 { return uint64(key) }).ComputeHash(keys[42], 16))
+}
+
+func TestComparable(t *testing.T) {
+	is := assert.New(t)
+
+	type user struct {
+		id   int
+		name string
+	}
+
+	is.Equal(XXHashString("hello"), Comparable("hello"))
+	is.Equal(Int(42), Comparable(42))
+	is.Equal(Int(42), Comparable(uint16(42)))
+	is.NotEqual(Comparable(true), Comparable(false))
+	is.NotEqual(Comparable(1.5), Comparable(2.5))
+	is.NotEqual(Comparable(float32(1.5)), Comparable(float32(2.5)))
+	is.Equal(Comparable(user{1, "a"}), Comparable(user{1, "a"}))
+	is.NotEqual(Comparable(user{1, "a"}), Comparable(user{2, "a"}))
+	is.NotEqual(Comparable([2]int{1, 2}), Comparable([2]int{2, 1}))
+
+	// named basic types
+	type userID string
+	type score float64
+	is.Equal(XXHashString("hello"), Comparable(userID("hello")))
+	is.Equal(Comparable(score(-0.0)), Comparable(score(0)))
+	is.Equal(Comparable(math.Copysign(0, -1)), Comparable(0.0))
+
+	// pointers by address, like ==
+	a, b := user{1, "a"}, user{1, "a"}
+	pointer := &a
+	hash := Comparable(pointer)
+	pointer.id = 2
+	is.Equal(hash, Comparable(pointer))
+	is.NotEqual(Comparable(&a), Comparable(&b))
+
+	// interfaces by dynamic value
+	is.Equal(Comparable[any](user{1, "a"}), Comparable(user{1, "a"}))
+	is.Equal(Comparable[any](nil), Comparable[any](nil))
+	is.Equal(Comparable(struct{ v any }{42}), Comparable(struct{ v any }{42}))
+	is.NotEqual(Comparable(struct{ v any }{42}), Comparable(struct{ v any }{43}))
+	is.NotEqual(Comparable(complex(1, 2)), Comparable(complex(2, 1)))
+
+	keys := make([]user, 20_000)
+	for i := range keys {
+		keys[i] = user{id: i, name: fmt.Sprintf("user-%d", i)}
+	}
+	assertDistribution(t, Comparable[user], keys, 8)
+
+	ints := make([]int, 100_000)
+	for i := range ints {
+		ints[i] = i * 16
+	}
+	assertDistribution(t, Comparable[int], ints, 16)
+}
+
+func TestAllocs(t *testing.T) {
+	is := assert.New(t)
+
+	str := "Nobody inspects the spammish repetition"
+	bytes := []byte(str)
+
+	is.Zero(testing.AllocsPerRun(100, func() { _ = FNV1aString(str) }))
+	is.Zero(testing.AllocsPerRun(100, func() { _ = FNV1aBytes(bytes) }))
+	is.Zero(testing.AllocsPerRun(100, func() { _ = XXHashString(str) }))
+	is.Zero(testing.AllocsPerRun(100, func() { _ = XXHashBytes(bytes) }))
+	is.Zero(testing.AllocsPerRun(100, func() { _ = Int(42) }))
+	is.Zero(testing.AllocsPerRun(100, func() { _ = Comparable(str) }))
+	is.Zero(testing.AllocsPerRun(100, func() { _ = Comparable(42) }))
+
+	type userID string
+	id := userID(str)
+	is.Zero(testing.AllocsPerRun(100, func() { _ = Comparable(id) }))
+	is.Zero(testing.AllocsPerRun(100, func() { _ = Comparable(uint16(42)) }))
+	is.Zero(testing.AllocsPerRun(100, func() { _ = Comparable(&str) }))
+}
+
+var benchSink uint64
+
+func BenchmarkFNV1aString(b *testing.B) {
+	for _, key := range []string{"user:42", "Nobody inspects the spammish repetition"} {
+		b.Run(strconv.Itoa(len(key)), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				benchSink = FNV1aString(key)
+			}
+		})
+	}
+}
+
+func BenchmarkXXHashString(b *testing.B) {
+	for _, key := range []string{"user:42", "Nobody inspects the spammish repetition"} {
+		b.Run(strconv.Itoa(len(key)), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				benchSink = XXHashString(key)
+			}
+		})
+	}
+}
+
+func BenchmarkXXHashBytes(b *testing.B) {
+	key := []byte("Nobody inspects the spammish repetition")
+	for i := 0; i < b.N; i++ {
+		benchSink = XXHashBytes(key)
+	}
+}
+
+func BenchmarkInt(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchSink = Int(i)
+	}
+}
+
+func BenchmarkComparable(b *testing.B) {
+	b.Run("int", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			benchSink = Comparable(i)
+		}
+	})
+	b.Run("string", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			benchSink = Comparable("user:42")
+		}
+	})
+	b.Run("struct", func(b *testing.B) {
+		type user struct {
+			id   int
+			name string
+		}
+		for i := 0; i < b.N; i++ {
+			benchSink = Comparable(user{id: i, name: "user"})
+		}
+	})
+}
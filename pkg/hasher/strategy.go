@@ -0,0 +1,150 @@
+package hasher
+
+import (
+	"sort"
+	"sync"
+)
+
+// Strategy maps a key to a shard index in [0, shards).
+// Hasher is a Strategy using modulo, which remaps almost every key when the number of shards changes.
+type Strategy[K any] interface {
+	ComputeHash(key K, shards uint64) uint64
+}
+
+var _ Strategy[string] = (Hasher[string])(nil)
+var _ Strategy[string] = (*ConsistentHash[string])(nil)
+var _ Strategy[string] = (*RendezvousHash[string])(nil)
+
+// NewConsistentHash creates a Strategy based on a hash ring. Each shard is placed `virtualNodes` times
+// on the ring. When the number of shards changes, only ~1/shards of the keys are remapped.
+// More virtual nodes give a more even distribution, at the cost of memory.
+func NewConsistentHash[K any](fn Hasher[K], virtualNodes int) *ConsistentHash[K] {
+	if fn == nil {
+		panic("hasher must not be nil")
+	}
+	if virtualNodes < 1 {
+		panic("virtual nodes must be a positive value")
+	}
+
+	return &ConsistentHash[K]{
+		fn:           fn,
+		virtualNodes: virtualNodes,
+		rings:        map[uint64]*ring{},
+	}
+}
+
+type ConsistentHash[K any] struct {
+	fn           Hasher[K]
+	virtualNodes int
+
+	mu    sync.RWMutex
+	rings map[uint64]*ring // indexed by number of shards
+}
+
+func (h *ConsistentHash[K]) ComputeHash(key K, shards uint64) uint64 {
+	return h.ring(shards).lookup(mix64(h.fn(key)))
+}
+
+// ring returns the ring of `shards` shards, built on first use.
+func (h *ConsistentHash[K]) ring(shards uint64) *ring {
+	h.mu.RLock()
+	r, ok := h.rings[shards]
+	h.mu.RUnlock()
+
+	if ok {
+		return r
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r, ok = h.rings[shards]; !ok {
+		r = newRing(shards, h.virtualNodes)
+		h.rings[shards] = r
+	}
+
+	return r
+}
+
+func newRing(shards uint64, virtualNodes int) *ring {
+	r := &ring{
+		points: make([]uint64, 0, shards*uint64(virtualNodes)),
+		owners: map[uint64]uint64{},
+	}
+
+	for shard := uint64(0); shard < shards; shard++ {
+		for node := uint64(0); node < uint64(virtualNodes); node++ {
+			point := mix64(shard<<32 | node)
+			if _, ok := r.owners[point]; ok {
+				continue // collision: very unlikely
+			}
+
+			r.points = append(r.points, point)
+			r.owners[point] = shard
+		}
+	}
+
+	sort.Slice(r.points, func(i, j int) bool {
+		return r.points[i] < r.points[j]
+	})
+
+	return r
+}
+
+type ring struct {
+	points []uint64 // sorted
+	owners map[uint64]uint64
+}
+
+// lookup returns the shard owning the first point clockwise from `hash`.
+func (r *ring) lookup(hash uint64) uint64 {
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= hash
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.owners[r.points[i]]
+}
+
+// NewRendezvousHash creates a Strategy based on highest random weight hashing: each key goes to the shard
+// with the highest score. When the number of shards changes, only ~1/shards of the keys are remapped.
+// Lookups are O(shards), which is fine for a small number of shards.
+func NewRendezvousHash[K any](fn Hasher[K]) *RendezvousHash[K] {
+	if fn == nil {
+		panic("hasher must not be nil")
+	}
+
+	return &RendezvousHash[K]{
+		fn: fn,
+	}
+}
+
+type RendezvousHash[K any] struct {
+	fn Hasher[K]
+}
+
+func (h *RendezvousHash[K]) ComputeHash(key K, shards uint64) uint64 {
+	hash := h.fn(key)
+
+	var best, bestScore uint64
+	for shard := uint64(0); shard < shards; shard++ {
+		score := mix64(hash ^ mix64(shard))
+		if shard == 0 || score > bestScore {
+			best, bestScore = shard, score
+		}
+	}
+
+	return best
+}
+
+// mix64 is the finalizer of splitmix64. It spreads the bits of poorly distributed hashes.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
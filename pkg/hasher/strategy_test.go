@@ -0,0 +1,108 @@
+package hasher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func identityHasher(key int) uint64 {
+	return uint64(key)
+}
+
+// moved returns the ratio of keys mapped to a different shard after resizing.
+func moved(strategy Strategy[int], keys int, from uint64, to uint64) float64 {
+	count := 0
+	for i := 0; i < keys; i++ {
+		if strategy.ComputeHash(i, from) != strategy.ComputeHash(i, to) {
+			count++
+		}
+	}
+
+	return float64(count) / float64(keys)
+}
+
+// spread returns the number of keys per shard.
+func spread(strategy Strategy[int], keys int, shards uint64) []int {
+	counts := make([]int, shards)
+	for i := 0; i < keys; i++ {
+		counts[strategy.ComputeHash(i, shards)]++
+	}
+
+	return counts
+}
+
+func TestConsistentHash(t *testing.T) {
+	is := assert.New(t)
+
+	is.Panics(func() {
+		NewConsistentHash[int](nil, 10)
+	})
+	is.Panics(func() {
+		NewConsistentHash(identityHasher, 0)
+	})
+
+	strategy := NewConsistentHash(identityHasher, 200)
+	for i := 0; i < 1000; i++ {
+		shard := strategy.ComputeHash(i, 10)
+		is.Less(shard, uint64(10))
+		is.Equal(shard, strategy.ComputeHash(i, 10))
+	}
+	is.Len(strategy.rings, 1)
+	is.Len(strategy.rings[10].points, 10*200)
+
+	for _, count := range spread(strategy, 100_000, 10) {
+		is.InEpsilon(10_000, count, 0.25)
+	}
+
+	// only ~1/11 of the keys are remapped
+	is.Less(moved(strategy, 100_000, 10, 11), 0.15)
+	// vs ~10/11 with modulo
+	is.Greater(moved(Hasher[int](identityHasher), 100_000, 10, 11), 0.85)
+}
+
+func TestConsistentHash_singleShard(t *testing.T) {
+	is := assert.New(t)
+
+	strategy := NewConsistentHash(identityHasher, 1)
+	for i := 0; i < 100; i++ {
+		is.Equal(uint64(0), strategy.ComputeHash(i, 1))
+	}
+}
+
+func TestRendezvousHash(t *testing.T) {
+	is := assert.New(t)
+
+	is.Panics(func() {
+		NewRendezvousHash[int](nil)
+	})
+
+	strategy := NewRendezvousHash(identityHasher)
+	for i := 0; i < 1000; i++ {
+		shard := strategy.ComputeHash(i, 10)
+		is.Less(shard, uint64(10))
+		is.Equal(shard, strategy.ComputeHash(i, 10))
+		is.Equal(uint64(0), strategy.ComputeHash(i, 1))
+	}
+
+	for _, count := range spread(strategy, 100_000, 10) {
+		is.InEpsilon(10_000, count, 0.1)
+	}
+
+	// only ~1/11 of the keys are remapped
+	is.Less(moved(strategy, 100_000, 10, 11), 0.12)
+}
+
+func BenchmarkConsistentHash(b *testing.B) {
+	strategy := NewConsistentHash(identityHasher, 100)
+	for i := 0; i < b.N; i++ {
+		_ = strategy.ComputeHash(i, 16)
+	}
+}
+
+func BenchmarkRendezvousHash(b *testing.B) {
+	strategy := NewRendezvousHash(identityHasher)
+	for i := 0; i < b.N; i++ {
+		_ = strategy.ComputeHash(i, 16)
+	}
+}
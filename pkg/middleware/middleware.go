@@ -0,0 +1,135 @@
+// Package middleware provides standard batchify.Middleware implementations.
+//
+//	batch := batchify.NewBatchConfig(100, do).
+//		WithMiddleware(
+//			middleware.Recover[int, string](),
+//			middleware.Retry[int, string](3, 10*time.Millisecond),
+//			middleware.Timeout[int, string](time.Second),
+//		).
+//		Build()
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/go-batchify"
+)
+
+// ErrPanic is returned by Recover when the callback panics. It is batchify.ErrCallbackPanic, returned
+// by the batch when the panic is not recovered.
+var ErrPanic = batchify.ErrCallbackPanic
+
+// Retry calls the callback up to `attempts` times, until it succeeds. The delay between
+// attempts starts at `backoff` and doubles on each retry. It stops early when the context is done.
+func Retry[I comparable, O any](attempts int, backoff time.Duration) batchify.Middleware[I, O] {
+	if attempts < 1 {
+		panic("attempts must be a positive value")
+	}
+	if backoff < 0 {
+		panic("backoff must be a positive value")
+	}
+
+	return func(next batchify.DoFunc[I, O]) batchify.DoFunc[I, O] {
+		return func(ctx context.Context, inputs []I) (map[I]O, error) {
+			delay := backoff
+
+			for attempt := 1; ; attempt++ {
+				outputs, err := next(ctx, inputs)
+				if err == nil || attempt == attempts {
+					return outputs, err
+				}
+
+				timer := time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return outputs, err
+				case <-timer.C:
+				}
+
+				delay *= 2
+			}
+		}
+	}
+}
+
+// Timeout cancels the context of the callback after `timeout`, and returns context.DeadlineExceeded to
+// the callers without waiting for the callback. The callback keeps running until it observes
+// the cancellation: it should honor its context. It receives a copy of the inputs, which might be
+// recycled by the batch in the meantime. A panic of the callback is raised again by Timeout, for an
+// outer Recover, unless the timeout has elapsed.
+func Timeout[I comparable, O any](timeout time.Duration) batchify.Middleware[I, O] {
+	if timeout <= 0 {
+		panic("timeout must be a positive value")
+	}
+
+	type result struct {
+		outputs map[I]O
+		err     error
+		panic   any
+	}
+
+	return func(next batchify.DoFunc[I, O]) batchify.DoFunc[I, O] {
+		return func(ctx context.Context, inputs []I) (map[I]O, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			done := make(chan result, 1)
+			go func(inputs []I) {
+				r := result{}
+				defer func() {
+					r.panic = recover()
+					done <- r
+				}()
+
+				r.outputs, r.err = next(ctx, inputs)
+			}(append([]I{}, inputs...))
+
+			select {
+			case r := <-done:
+				if r.panic != nil {
+					panic(r.panic)
+				}
+				return r.outputs, r.err
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+}
+
+// Recover converts a panic of the callback into an error wrapping ErrPanic, returned to every caller.
+func Recover[I comparable, O any]() batchify.Middleware[I, O] {
+	return func(next batchify.DoFunc[I, O]) batchify.DoFunc[I, O] {
+		return func(ctx context.Context, inputs []I) (outputs map[I]O, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					outputs, err = nil, fmt.Errorf("%w: %v", ErrPanic, r)
+				}
+			}()
+
+			return next(ctx, inputs)
+		}
+	}
+}
+
+// Observe calls `fn` after each invocation of the callback, eg: to collect metrics.
+func Observe[I comparable, O any](fn func(info batchify.BatchInfo, duration time.Duration, err error)) batchify.Middleware[I, O] {
+	if fn == nil {
+		panic("observer must not be nil")
+	}
+
+	return func(next batchify.DoFunc[I, O]) batchify.DoFunc[I, O] {
+		return func(ctx context.Context, inputs []I) (map[I]O, error) {
+			info, _ := batchify.InfoFromContext(ctx)
+
+			start := time.Now()
+			outputs, err := next(ctx, inputs)
+			fn(info, time.Since(start), err)
+
+			return outputs, err
+		}
+	}
+}
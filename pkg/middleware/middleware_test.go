@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samber/go-batchify"
+	"github.com/stretchr/testify/assert"
+)
+
+func double(_ context.Context, inputs []int) (map[int]int, error) {
+	out := map[int]int{}
+	for _, input := range inputs {
+		out[input] = input * 2
+	}
+	return out, nil
+}
+
+// failing fails `failures` times, then calls double.
+func failing(failures int) (batchify.DoFunc[int, int], *int) {
+	calls := 0
+	return func(ctx context.Context, inputs []int) (map[int]int, error) {
+		calls++
+		if calls <= failures {
+			return nil, assert.AnError
+		}
+		return double(ctx, inputs)
+	}, &calls
+}
+
+func TestRetry(t *testing.T) {
+	is := assert.New(t)
+
+	do, calls := failing(2)
+	outputs, err := Retry[int, int](3, time.Millisecond)(do)(context.Background(), []int{1})
+	is.Nil(err)
+	is.Equal(map[int]int{1: 2}, outputs)
+	is.Equal(3, *calls)
+
+	do, calls = failing(5)
+	start := time.Now()
+	_, err = Retry[int, int](3, 10*time.Millisecond)(do)(context.Background(), []int{1})
+	is.ErrorIs(err, assert.AnError)
+	is.Equal(3, *calls)
+	is.GreaterOrEqual(time.Since(start), 30*time.Millisecond) // 10ms + 20ms
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	do, calls = failing(5)
+	_, err = Retry[int, int](3, time.Hour)(do)(ctx, []int{1})
+	is.ErrorIs(err, assert.AnError)
+	is.Equal(1, *calls)
+
+	is.Panics(func() {
+		Retry[int, int](0, time.Millisecond)
+	})
+	is.Panics(func() {
+		Retry[int, int](1, -time.Millisecond)
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	is := assert.New(t)
+
+	outputs, err := Timeout[int, int](time.Second)(double)(context.Background(), []int{1})
+	is.Nil(err)
+	is.Equal(map[int]int{1: 2}, outputs)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	slow := func(ctx context.Context, inputs []int) (map[int]int, error) {
+		defer wg.Done()
+		<-ctx.Done()
+		return nil, errors.New("canceled")
+	}
+
+	start := time.Now()
+	outputs, err = Timeout[int, int](10*time.Millisecond)(slow)(context.Background(), []int{1})
+	is.ErrorIs(err, context.DeadlineExceeded)
+	is.Nil(outputs)
+	is.Less(time.Since(start), time.Second)
+	wg.Wait()
+
+	is.Panics(func() {
+		Timeout[int, int](0)
+	})
+}
+
+func TestTimeout_recover(t *testing.T) {
+	is := assert.New(t)
+
+	panicking := func(ctx context.Context, inputs []int) (map[int]int, error) {
+		panic("boom")
+	}
+
+	// the panic of the callback goroutine reaches the outer Recover
+	do := Recover[int, int]()(Timeout[int, int](time.Second)(panicking))
+	outputs, err := do(context.Background(), []int{1})
+	is.ErrorIs(err, ErrPanic)
+	is.Nil(outputs)
+}
+
+func TestTimeout_pooling(t *testing.T) {
+	is := assert.New(t)
+
+	var wg sync.WaitGroup
+	slow := func(ctx context.Context, inputs []int) (map[int]int, error) {
+		defer wg.Done()
+		<-ctx.Done()
+		time.Sleep(5 * time.Millisecond)
+
+		// read after the batch recycled its buffer
+		return double(ctx, inputs)
+	}
+
+	batch := batchify.NewBatchConfigWithContext(10, slow).
+		WithMiddleware(Timeout[int, int](time.Millisecond)).
+		WithBufferPooling().
+		Build()
+	defer batch.Stop()
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		_, err := batch.DoWithPriority(i, batchify.PriorityHigh)
+		is.ErrorIs(err, context.DeadlineExceeded)
+	}
+
+	wg.Wait()
+}
+
+func TestRecover(t *testing.T) {
+	is := assert.New(t)
+
+	outputs, err := Recover[int, int]()(double)(context.Background(), []int{1})
+	is.Nil(err)
+	is.Equal(map[int]int{1: 2}, outputs)
+
+	outputs, err = Recover[int, int]()(func(ctx context.Context, inputs []int) (map[int]int, error) {
+		panic("boom")
+	})(context.Background(), []int{1})
+	is.ErrorIs(err, ErrPanic)
+	is.EqualError(err, "batch callback panicked: boom")
+	is.Nil(outputs)
+}
+
+func TestObserve(t *testing.T) {
+	is := assert.New(t)
+
+	var mu sync.Mutex
+	observed := []batchify.BatchInfo{}
+
+	batch := batchify.NewBatchConfigWithContext[int, int](2, double).
+		WithSharding(2, func(key int) uint64 { return uint64(key) }).
+		WithMiddleware(
+			Observe[int, int](func(info batchify.BatchInfo, duration time.Duration, err error) {
+				mu.Lock()
+				observed = append(observed, info)
+				mu.Unlock()
+				is.Nil(err)
+				is.GreaterOrEqual(duration, time.Duration(0))
+			}),
+		).
+		Build()
+	defer batch.Stop()
+
+	result, err := batch.DoWithPriority(3, batchify.PriorityHigh)
+	is.Nil(err)
+	is.Equal(6, result)
+
+	mu.Lock()
+	defer mu.Unlock()
+	is.Len(observed, 1)
+	is.Equal(1, observed[0].Shard)
+	is.Equal(batchify.FlushReasonPriority, observed[0].Reason)
+	is.Equal(1, observed[0].Size)
+
+	is.Panics(func() {
+		Observe[int, int](nil)
+	})
+}
@@ -0,0 +1,37 @@
+package batchify
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+)
+
+// profile runs `fn` with pprof labels and a runtime/trace task, when the batch is named. See BatchConfig.WithName.
+func (b *batchImpl[I, K, O]) profile(ctx context.Context, info BatchInfo, fn func(ctx context.Context)) {
+	if b.name == "" {
+		fn(ctx)
+		return
+	}
+
+	labels := pprof.Labels(
+		"batcher", b.name,
+		"shard", strconv.Itoa(info.Shard),
+		"reason", string(info.Reason),
+	)
+
+	pprof.Do(ctx, labels, func(ctx context.Context) {
+		if !trace.IsEnabled() {
+			fn(ctx)
+			return
+		}
+
+		ctx, task := trace.NewTask(ctx, "batchify.batch")
+		defer task.End()
+
+		trace.Logf(ctx, "batchify", "batcher=%s shard=%d reason=%s size=%d", b.name, info.Shard, info.Reason, info.Size)
+		trace.WithRegion(ctx, "batchify.callback", func() {
+			fn(ctx)
+		})
+	})
+}
@@ -0,0 +1,86 @@
+package batchify
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchImpl_profile(t *testing.T) {
+	is := assert.New(t)
+
+	labels := map[string]string{}
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 2,
+		key:        identity[string],
+		name:       "users",
+		shard:      3,
+		doWithContext: func(ctx context.Context, inputs []string) (map[string]string, error) {
+			pprof.ForLabels(ctx, func(key, value string) bool {
+				labels[key] = value
+				return true
+			})
+
+			info, ok := InfoFromContext(ctx)
+			is.True(ok)
+			is.Equal("users", info.Name)
+
+			return mockDoOk(inputs)
+		},
+	})
+	defer b.Stop()
+
+	result, err := b.DoWithPriority("a", PriorityHigh)
+	is.Nil(err)
+	is.Equal("aa", result)
+	is.Equal(map[string]string{"batcher": "users", "shard": "3", "reason": "priority"}, labels)
+	is.Equal("users", b.Settings().Name)
+}
+
+func TestBatchImpl_profile_unnamed(t *testing.T) {
+	is := assert.New(t)
+
+	b := newBatch(2, 0, mockDoOk)
+	defer b.Stop()
+
+	called := false
+	b.profile(context.Background(), BatchInfo{}, func(ctx context.Context) {
+		_, ok := pprof.Label(ctx, "batcher")
+		is.False(ok)
+		called = true
+	})
+	is.True(called)
+}
+
+func TestBatchImpl_profile_trace(t *testing.T) {
+	is := assert.New(t)
+
+	var output bytes.Buffer
+	if err := trace.Start(&output); err != nil {
+		t.Skip("tracing already enabled")
+	}
+
+	b := newBatchWithOptions(batchOptions[string, string, string]{
+		bufferSize: 2,
+		key:        identity[string],
+		do:         mockDoOk,
+		name:       "users",
+	})
+	defer b.Stop()
+
+	called := false
+	b.profile(context.Background(), BatchInfo{Reason: FlushReasonManual, Size: 1}, func(ctx context.Context) {
+		value, ok := pprof.Label(ctx, "batcher")
+		is.True(ok)
+		is.Equal("users", value)
+		called = true
+	})
+
+	trace.Stop()
+	is.True(called)
+	is.Contains(output.String(), "batchify.batch")
+}
@@ -1,60 +1,297 @@
 package batchify
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 
 	"github.com/samber/go-batchify/internal"
 	"github.com/samber/go-batchify/pkg/hasher"
+	"github.com/samber/lo"
 )
 
-func newShardedBatch[I comparable, O any](
-	batches []Batch[I, O],
-	shardingFn hasher.Hasher[I],
+func newShardedBatch[I any, O any](
+	shards int,
+	build func(shard int) Batch[I, O],
+	shardingFn hasher.Strategy[I],
 ) *shardedBatchImpl[I, O] {
-	return &shardedBatchImpl[I, O]{
-		shards:     uint64(len(batches)),
-		batches:    batches,
+	b := &shardedBatchImpl[I, O]{
+		mu:         sync.RWMutex{},
+		table:      atomic.Pointer[shardTable[I, O]]{},
+		build:      build,
 		shardingFn: shardingFn,
+		paused:     false,
+		stopped:    false,
+		retired:    nil,
+		draining:   nil,
+		folded:     Stats{},
 	}
+
+	b.table.Store(&shardTable[I, O]{
+		shards:  uint64(shards),
+		batches: lo.RepeatBy(shards, build),
+	})
+
+	return b
 }
 
-var _ Batch[string, int] = (*shardedBatchImpl[string, int])(nil)
+var _ ShardedBatch[string, int] = (*shardedBatchImpl[string, int])(nil)
 
-type shardedBatchImpl[I comparable, O any] struct {
+type shardedBatchImpl[I any, O any] struct {
 	_ internal.NoCopy
 
-	shards     uint64
-	batches    []Batch[I, O]
-	shardingFn hasher.Hasher[I]
+	// mu serializes Resize, and protects the fields below. Do() only loads the table.
+	mu    sync.RWMutex
+	table atomic.Pointer[shardTable[I, O]]
+
+	build      func(shard int) Batch[I, O]
+	shardingFn hasher.Strategy[I]
+	paused     bool // applies to the shards created by Resize
+	stopped    bool // applies to the shards created by Resize
+
+	// shards replaced by Resize while paused, stopped on Resume
+	retired []Batch[I, O]
+	// shards replaced by Resize, being stopped
+	draining []Batch[I, O]
+	// counters of the stopped shards, see Stats
+	folded Stats
+}
+
+// shardTable routes inputs to the shards. It is replaced by Resize, never modified.
+type shardTable[I any, O any] struct {
+	shards  uint64
+	batches []Batch[I, O]
 }
 
 func (b *shardedBatchImpl[I, O]) Do(input I) (output O, err error) {
-	shardIdx := b.shardingFn.ComputeHash(input, b.shards)
-	return b.batches[shardIdx].Do(input)
+	return b.shard(input).Do(input)
+}
+
+func (b *shardedBatchImpl[I, O]) DoWithPriority(input I, priority Priority) (output O, err error) {
+	return b.shard(input).DoWithPriority(input, priority)
+}
+
+func (b *shardedBatchImpl[I, O]) DoWithContext(ctx context.Context, input I) (output O, err error) {
+	return b.shard(input).DoWithContext(ctx, input)
 }
 
 func (b *shardedBatchImpl[I, O]) Flush() {
+	b.each(func(b Batch[I, O]) {
+		b.Flush()
+	})
+}
+
+// FlushAndWait flushes every shard concurrently, including the shards replaced by Resize,
+// and joins the errors of their callbacks.
+func (b *shardedBatchImpl[I, O]) FlushAndWait(ctx context.Context) error {
+	b.mu.RLock()
+	batches := append(append(append([]Batch[I, O]{}, b.routes().batches...), b.retired...), b.draining...)
+	b.mu.RUnlock()
+
+	errs := make([]error, len(batches))
+
 	var wg sync.WaitGroup
-	wg.Add(len(b.batches))
+	wg.Add(len(batches))
 
-	for _, batch := range b.batches {
-		go func(b Batch[I, O]) {
+	for i, batch := range batches {
+		go func(i int, b Batch[I, O]) {
 			defer wg.Done()
-			b.Flush()
-		}(batch)
+			errs[i] = b.FlushAndWait(ctx)
+		}(i, batch)
 	}
 
 	wg.Wait()
+
+	return errors.Join(errs...)
 }
 
+// Stop stops every shard, including the shards replaced by Resize while paused.
 func (b *shardedBatchImpl[I, O]) Stop() {
+	b.mu.Lock()
+	b.stopped = true
+	batches := b.routes().batches
+	retired := b.retired
+	b.retired = nil
+	b.draining = append(b.draining, retired...)
+	b.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.drain(retired)
+	}()
+
+	forEachParallel(batches, func(b Batch[I, O]) {
+		b.Stop()
+	})
+
+	wg.Wait()
+}
+
+// Pause pauses every shard. See BatchConfig.WithPauseLimit for the limit of waiting callers, which applies per shard.
+func (b *shardedBatchImpl[I, O]) Pause() {
+	b.mu.Lock()
+	b.paused = true
+	batches := b.routes().batches
+	b.mu.Unlock()
+
+	forEachParallel(batches, func(b Batch[I, O]) {
+		b.Pause()
+	})
+}
+
+// Resume resumes every shard, and drains the shards replaced by Resize in the meantime.
+func (b *shardedBatchImpl[I, O]) Resume() {
+	b.mu.Lock()
+	b.paused = false
+	batches := b.routes().batches
+	retired := b.retired
+	b.retired = nil
+	b.draining = append(b.draining, retired...)
+	b.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.drain(retired)
+	}()
+
+	forEachParallel(batches, func(b Batch[I, O]) {
+		b.Resume()
+	})
+
+	wg.Wait()
+}
+
+// Stats returns the sum of the stats of every shard, including the shards replaced by Resize.
+func (b *shardedBatchImpl[I, O]) Stats() Stats {
+	// under lock, so that shards are not counted twice while being folded
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := b.folded
+	for _, batches := range [][]Batch[I, O]{b.routes().batches, b.retired, b.draining} {
+		for _, batch := range batches {
+			stats = stats.merge(batch.Stats())
+		}
+	}
+
+	return stats
+}
+
+// Settings returns the settings of every shard. See Settings.Shards.
+func (b *shardedBatchImpl[I, O]) Settings() Settings {
+	batches := b.routes().batches
+
+	shards := make([]Settings, 0, len(batches))
+	for _, batch := range batches {
+		settings := Settings{}
+		if provider, ok := batch.(interface{ Settings() Settings }); ok {
+			settings = provider.Settings()
+		}
+
+		shards = append(shards, settings)
+	}
+
+	settings := shards[0]
+	settings.Shards = shards
+	return settings
+}
+
+// Resize replaces the shards with `shards` new ones. Inputs received during the switch are routed
+// to the new shards, while the pending inputs of the previous shards are flushed. After Stop(),
+// the new shards are stopped as well: inputs are dispatched right away.
+func (b *shardedBatchImpl[I, O]) Resize(shards int) {
+	assertValue(shards >= 1, "shards must be a positive value")
+
+	b.mu.Lock()
+
+	if uint64(shards) == b.routes().shards {
+		b.mu.Unlock()
+		return
+	}
+
+	previous := b.routes().batches
+	table := &shardTable[I, O]{
+		shards:  uint64(shards),
+		batches: lo.RepeatBy(shards, b.build),
+	}
+
+	// before being published: Do() must not buffer inputs in a live shard of a stopped batch
+	if b.stopped {
+		forEachParallel(table.batches, func(b Batch[I, O]) {
+			b.Stop()
+		})
+	}
+
+	b.table.Store(table)
+
+	if b.paused {
+		for _, batch := range table.batches {
+			batch.Pause()
+		}
+
+		// the previous shards keep their inputs until Resume()
+		b.retired = append(b.retired, previous...)
+		b.mu.Unlock()
+		return
+	}
+
+	b.draining = append(b.draining, previous...)
+
+	b.mu.Unlock()
+
+	// Late inputs, routed to a previous shard before the switch, are dispatched right away by the stopped shard.
+	b.drain(previous)
+}
+
+// drain stops the shards replaced by Resize, then folds their counters into the sharded batch.
+// The shards must have been added to `draining`.
+func (b *shardedBatchImpl[I, O]) drain(batches []Batch[I, O]) {
+	if len(batches) == 0 {
+		return
+	}
+
+	forEachParallel(batches, func(b Batch[I, O]) {
+		b.Stop()
+	})
+
+	b.mu.Lock()
+	for _, batch := range batches {
+		b.folded = b.folded.merge(batch.Stats())
+	}
+	b.draining = lo.Without(b.draining, batches...)
+	b.mu.Unlock()
+}
+
+func (b *shardedBatchImpl[I, O]) shard(input I) Batch[I, O] {
+	table := b.routes()
+
+	shardIdx := b.shardingFn.ComputeHash(input, table.shards)
+	return table.batches[shardIdx]
+}
+
+// routes returns the current shards.
+func (b *shardedBatchImpl[I, O]) routes() *shardTable[I, O] {
+	return b.table.Load()
+}
+
+// each calls `cb` on every shard concurrently.
+func (b *shardedBatchImpl[I, O]) each(cb func(Batch[I, O])) {
+	forEachParallel(b.routes().batches, cb)
+}
+
+func forEachParallel[I any, O any](batches []Batch[I, O], cb func(Batch[I, O])) {
 	var wg sync.WaitGroup
-	wg.Add(len(b.batches))
+	wg.Add(len(batches))
 
-	for _, batch := range b.batches {
+	for _, batch := range batches {
 		go func(b Batch[I, O]) {
 			defer wg.Done()
-			b.Stop()
+			cb(b)
 		}(batch)
 	}
 
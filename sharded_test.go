@@ -1,9 +1,14 @@
 package batchify
 
 import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/samber/go-batchify/pkg/hasher"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,8 +19,8 @@ func TestNewShardedBatch(t *testing.T) {
 		newBatch(42, 0, mockDoOk),
 		newBatch(42, 0, mockDoOk),
 	}
-	b := newShardedBatch(batches, mockHasher)
-	is.Len(b.batches, 2)
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] { return batches[i] }, mockHasher)
+	is.Len(b.routes().batches, 2)
 	is.NotNil(b.shardingFn)
 }
 
@@ -26,29 +31,19 @@ func TestNewShardedBatch_Flush(t *testing.T) {
 		newBatch(42, 5*time.Millisecond, mockDoOk),
 		newBatch(42, 5*time.Millisecond, mockDoOk),
 	}
-	b := newShardedBatch(batches, mockHasher)
-	is.Len(b.batches, 2)
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] { return batches[i] }, mockHasher)
+	is.Len(b.routes().batches, 2)
 	is.NotNil(b.shardingFn)
 
-	batches[0].(*batchImpl[string, string]).mu.Lock()
-	batches[0].(*batchImpl[string, string]).buffer.values["key"] = ""
-	batches[0].(*batchImpl[string, string]).buffer.size++
-	batches[0].(*batchImpl[string, string]).mu.Unlock()
-	is.Len(batches[0].(*batchImpl[string, string]).buffer.values, 1)
-	is.Equal(1, batches[0].(*batchImpl[string, string]).buffer.size)
+	batches[0].(*batchImpl[string, string, string]).enqueue("key", "key", PriorityNormal)
+	is.Equal(1, batches[0].(*batchImpl[string, string, string]).current().len())
 
-	batches[1].(*batchImpl[string, string]).mu.Lock()
-	batches[1].(*batchImpl[string, string]).buffer.values["key"] = ""
-	batches[1].(*batchImpl[string, string]).buffer.size++
-	batches[1].(*batchImpl[string, string]).mu.Unlock()
-	is.Len(batches[1].(*batchImpl[string, string]).buffer.values, 1)
-	is.Equal(1, batches[1].(*batchImpl[string, string]).buffer.size)
+	batches[1].(*batchImpl[string, string, string]).enqueue("key", "key", PriorityNormal)
+	is.Equal(1, batches[1].(*batchImpl[string, string, string]).current().len())
 
 	b.Flush()
-	is.Len(batches[0].(*batchImpl[string, string]).buffer.values, 0)
-	is.Equal(0, batches[0].(*batchImpl[string, string]).buffer.size)
-	is.Len(batches[1].(*batchImpl[string, string]).buffer.values, 0)
-	is.Equal(0, batches[1].(*batchImpl[string, string]).buffer.size)
+	is.Equal(0, batches[0].(*batchImpl[string, string, string]).current().len())
+	is.Equal(0, batches[1].(*batchImpl[string, string, string]).current().len())
 }
 
 func TestNewShardedBatch_Stop(t *testing.T) {
@@ -58,27 +53,333 @@ func TestNewShardedBatch_Stop(t *testing.T) {
 		newBatch(42, 5*time.Millisecond, mockDoOk),
 		newBatch(42, 5*time.Millisecond, mockDoOk),
 	}
-	b := newShardedBatch(batches, mockHasher)
-	is.Len(b.batches, 2)
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] { return batches[i] }, mockHasher)
+	is.Len(b.routes().batches, 2)
 	is.NotNil(b.shardingFn)
 
-	batches[0].(*batchImpl[string, string]).mu.Lock()
-	batches[0].(*batchImpl[string, string]).buffer.values["key"] = ""
-	batches[0].(*batchImpl[string, string]).buffer.size++
-	batches[0].(*batchImpl[string, string]).mu.Unlock()
-	is.Len(batches[0].(*batchImpl[string, string]).buffer.values, 1)
-	is.Equal(1, batches[0].(*batchImpl[string, string]).buffer.size)
+	batches[0].(*batchImpl[string, string, string]).enqueue("key", "key", PriorityNormal)
+	is.Equal(1, batches[0].(*batchImpl[string, string, string]).current().len())
 
-	batches[1].(*batchImpl[string, string]).mu.Lock()
-	batches[1].(*batchImpl[string, string]).buffer.values["key"] = ""
-	batches[1].(*batchImpl[string, string]).buffer.size++
-	batches[1].(*batchImpl[string, string]).mu.Unlock()
-	is.Len(batches[1].(*batchImpl[string, string]).buffer.values, 1)
-	is.Equal(1, batches[1].(*batchImpl[string, string]).buffer.size)
+	batches[1].(*batchImpl[string, string, string]).enqueue("key", "key", PriorityNormal)
+	is.Equal(1, batches[1].(*batchImpl[string, string, string]).current().len())
 
 	b.Stop()
-	is.Len(batches[0].(*batchImpl[string, string]).buffer.values, 0)
-	is.Equal(0, batches[0].(*batchImpl[string, string]).buffer.size)
-	is.Len(batches[1].(*batchImpl[string, string]).buffer.values, 0)
-	is.Equal(0, batches[1].(*batchImpl[string, string]).buffer.size)
+	is.Equal(0, batches[0].(*batchImpl[string, string, string]).current().len())
+	is.Equal(0, batches[1].(*batchImpl[string, string, string]).current().len())
+}
+
+func TestNewShardedBatch_DoWithPriority(t *testing.T) {
+	is := assert.New(t)
+
+	batches := []Batch[string, string]{
+		newBatch(42, 0, mockDoOk),
+		newBatch(42, 0, mockDoOk),
+	}
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] { return batches[i] }, mockHasher)
+	defer b.Stop()
+
+	result, err := b.DoWithPriority("a", PriorityHigh)
+	is.Nil(err)
+	is.Equal("aa", result)
+
+	result, err = b.DoWithPriority("ab", PriorityHigh)
+	is.Nil(err)
+	is.Equal("abab", result)
+}
+
+func TestNewShardedBatch_DoWithContext(t *testing.T) {
+	is := assert.New(t)
+
+	batches := []Batch[string, string]{
+		newBatch(42, 0, mockDoOk),
+		newBatch(42, 0, mockDoOk),
+	}
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] { return batches[i] }, mockHasher)
+	defer b.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// no timer: the deadline flushes the shard, ahead of the margin
+	result, err := b.DoWithContext(ctx, "ab")
+	is.Nil(err)
+	is.Equal("abab", result)
+	is.EqualValues(1, b.Stats().Flushes[FlushReasonDeadline])
+}
+
+func TestNewShardedBatch_FlushAndWait(t *testing.T) {
+	is := assert.New(t)
+
+	batches := []*batchImpl[string, string, string]{
+		newBatch(42, 0, mockDoKo),
+		newBatch(42, 0, mockDoOk),
+		newBatch(42, 0, mockDoKo),
+	}
+	b := newShardedBatch[string, string](3, func(i int) Batch[string, string] { return batches[i] }, mockHasher)
+	defer b.Stop()
+
+	is.Nil(b.FlushAndWait(context.Background()))
+
+	batches[1].enqueue("a", "a", PriorityNormal)
+	is.Nil(b.FlushAndWait(context.Background()))
+	is.EqualValues(1, b.Stats().Flushes[FlushReasonManual])
+
+	batches[0].enqueue("abc", "abc", PriorityNormal)
+	batches[1].enqueue("a", "a", PriorityNormal)
+	batches[2].enqueue("ab", "ab", PriorityNormal)
+	err := b.FlushAndWait(context.Background())
+	is.ErrorIs(err, assert.AnError)
+	is.Len(err.(interface{ Unwrap() []error }).Unwrap(), 2)
+	for _, batch := range batches {
+		is.Equal(0, batch.current().len())
+	}
+}
+
+func TestNewShardedBatch_Pause(t *testing.T) {
+	is := assert.New(t)
+
+	var calls int32
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] {
+		return newBatch(42, 0, func(keys []string) (map[string]string, error) {
+			atomic.AddInt32(&calls, 1)
+			return mockDoOk(keys)
+		})
+	}, mockHasher)
+	defer b.Stop()
+
+	b.Pause()
+
+	// a held buffer in shard 1, a pending input in shard 0, and an input for the next shards
+	var wg sync.WaitGroup
+	for _, input := range []string{"a", "ab", "abc"} {
+		wg.Add(1)
+		go func(input string) {
+			defer wg.Done()
+			priority := PriorityNormal
+			if input != "ab" {
+				priority = PriorityHigh
+			}
+
+			result, err := b.DoWithPriority(input, priority)
+			is.Nil(err)
+			is.Equal(input+input, result)
+		}(input)
+
+		if input == "ab" {
+			time.Sleep(5 * time.Millisecond)
+			b.Resize(3)
+			for _, batch := range b.routes().batches {
+				is.EqualValues(1, batch.(*batchImpl[string, string, string]).paused)
+			}
+		}
+	}
+
+	// the previous shards are not drained during the maintenance window
+	time.Sleep(20 * time.Millisecond)
+	is.EqualValues(0, atomic.LoadInt32(&calls))
+	is.Len(b.retired, 2)
+
+	b.Resume()
+	wg.Wait()
+	is.EqualValues(3, atomic.LoadInt32(&calls))
+	is.Empty(b.retired)
+	for _, batch := range b.routes().batches {
+		is.EqualValues(0, batch.(*batchImpl[string, string, string]).paused)
+	}
+}
+
+func TestNewShardedBatch_Stats(t *testing.T) {
+	is := assert.New(t)
+
+	batches := []Batch[string, string]{
+		newBatch(42, 0, mockDoOk),
+		newBatch(42, 0, mockDoOk),
+	}
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] { return batches[i] }, mockHasher)
+
+	batches[0].(*batchImpl[string, string, string]).enqueue("a", "a", PriorityNormal)
+	batches[0].(*batchImpl[string, string, string]).enqueue("b", "b", PriorityNormal)
+	batches[1].(*batchImpl[string, string, string]).enqueue("c", "c", PriorityNormal)
+
+	stats := b.Stats()
+	is.Equal(3, stats.Pending)
+	is.EqualValues(3, stats.Inputs)
+	is.True(stats.LastFlush.IsZero())
+
+	b.Stop()
+
+	stats = b.Stats()
+	is.Equal(0, stats.Pending)
+	is.EqualValues(2, stats.Flushes[FlushReasonStop])
+	is.False(stats.LastFlush.IsZero())
+}
+
+func TestNewShardedBatch_Stats_resize(t *testing.T) {
+	is := assert.New(t)
+
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] {
+		return newBatch(42, 0, mockDoKo)
+	}, mockHasher)
+	defer b.Stop()
+
+	_, _ = b.DoWithPriority("a", PriorityHigh)
+	_, _ = b.DoWithPriority("ab", PriorityHigh)
+	b.routes().batches[0].(*batchImpl[string, string, string]).enqueue("abc", "abc", PriorityNormal)
+
+	// the counters of the previous shards are kept
+	b.Resize(3)
+	stats := b.Stats()
+	is.EqualValues(3, stats.Inputs)
+	is.EqualValues(2, stats.Flushes[FlushReasonPriority])
+	is.EqualValues(1, stats.Flushes[FlushReasonStop])
+	is.EqualValues(3, stats.Errors)
+	is.Len(stats.History, 3)
+	is.Empty(b.draining)
+
+	// and while paused
+	b.Pause()
+	b.routes().batches[1].(*batchImpl[string, string, string]).enqueue("a", "a", PriorityNormal)
+	b.Resize(1)
+	is.EqualValues(4, b.Stats().Inputs)
+	b.Resume()
+
+	stats = b.Stats()
+	is.EqualValues(4, stats.Inputs)
+	is.EqualValues(2, stats.Flushes[FlushReasonStop])
+	is.Empty(b.retired)
+	is.Empty(b.draining)
+}
+
+func TestNewShardedBatch_Settings(t *testing.T) {
+	is := assert.New(t)
+
+	batches := []Batch[string, string]{
+		newBatch(42, 0, mockDoOk),
+		newBatch(21, 5*time.Millisecond, mockDoOk),
+	}
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] { return batches[i] }, mockHasher)
+	defer b.Stop()
+
+	is.Equal(
+		Settings{
+			BufferSize: 42,
+			Shards: []Settings{
+				{BufferSize: 42},
+				{BufferSize: 21, TTL: 5 * time.Millisecond},
+			},
+		},
+		b.Settings(),
+	)
+}
+
+func TestNewShardedBatch_Resize(t *testing.T) {
+	is := assert.New(t)
+
+	built := 0
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] {
+		built++
+		return newBatch(42, 0, mockDoOk)
+	}, mockHasher)
+	defer b.Stop()
+	is.Equal(2, built)
+
+	// pending input in a previous shard
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, err := b.Do("a")
+		is.Nil(err)
+		is.Equal("aa", result)
+	}()
+	time.Sleep(2 * time.Millisecond)
+
+	previous := b.routes().batches
+	b.Resize(3)
+	<-done
+	is.Equal(5, built)
+	is.EqualValues(3, b.routes().shards)
+	is.Len(b.routes().batches, 3)
+	for _, batch := range previous {
+		is.EqualValues(1, batch.(*batchImpl[string, string, string]).stopped)
+	}
+
+	// late input routed to a previous shard
+	result, err := previous[1].Do("a")
+	is.Nil(err)
+	is.Equal("aa", result)
+
+	// same size: no-op
+	b.Resize(3)
+	is.Equal(5, built)
+
+	is.Panics(func() {
+		b.Resize(0)
+	})
+
+	result, err = b.DoWithPriority("abc", PriorityHigh)
+	is.Nil(err)
+	is.Equal("abcabc", result)
+}
+
+func TestNewShardedBatch_ResizeStopped(t *testing.T) {
+	is := assert.New(t)
+
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] {
+		return newBatch(42, time.Hour, mockDoOk)
+	}, mockHasher)
+	b.Stop()
+
+	b.Resize(3)
+	for _, batch := range b.routes().batches {
+		is.EqualValues(1, batch.(*batchImpl[string, string, string]).stopped)
+	}
+
+	// dispatched right away, despite the timer
+	result, err := b.Do("a")
+	is.Nil(err)
+	is.Equal("aa", result)
+	is.Equal(uint64(1), b.Stats().Flushes[FlushReasonStop])
+}
+
+func TestNewShardedBatch_routing(t *testing.T) {
+	is := assert.New(t)
+
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] {
+		return newBatch(42, 0, mockDoOk)
+	}, mockHasher)
+	defer b.Stop()
+
+	// routing does not take the lock of Resize
+	b.mu.Lock()
+	result, err := b.DoWithPriority("a", PriorityHigh)
+	b.mu.Unlock()
+	is.Nil(err)
+	is.Equal("aa", result)
+}
+
+func TestNewShardedBatch_ResizeConcurrent(t *testing.T) {
+	is := assert.New(t)
+
+	b := newShardedBatch[string, string](2, func(i int) Batch[string, string] {
+		return newBatch(5, time.Millisecond, mockDoOk)
+	}, hasher.Hasher[string](hasher.FNV1aString))
+	defer b.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := strconv.Itoa(i)
+			result, err := b.Do(key)
+			is.Nil(err)
+			is.Equal(key+key, result)
+		}(i)
+
+		if i%20 == 0 {
+			b.Resize(i/20 + 1)
+		}
+	}
+
+	wg.Wait()
 }
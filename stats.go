@@ -0,0 +1,183 @@
+package batchify
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FlushReason describes why a buffer has been dispatched.
+type FlushReason string
+
+const (
+	// FlushReasonSize is used when the buffer is full.
+	FlushReasonSize FlushReason = "size"
+	// FlushReasonTimer is used when the timer ends.
+	FlushReasonTimer FlushReason = "timer"
+	// FlushReasonPriority is used when a high-priority input is received.
+	FlushReasonPriority FlushReason = "priority"
+	// FlushReasonManual is used by Batch.Flush().
+	FlushReasonManual FlushReason = "manual"
+	// FlushReasonStop is used by Batch.Stop(), and for inputs received after Stop().
+	FlushReasonStop FlushReason = "stop"
+	// FlushReasonIdle is used when no callback is in flight. See BatchConfig.WithIdleDispatch.
+	FlushReasonIdle FlushReason = "idle"
+	// FlushReasonDeadline is used when the deadline of a waiter is close. See Batch.DoWithContext.
+	FlushReasonDeadline FlushReason = "deadline"
+)
+
+var flushReasons = [...]FlushReason{FlushReasonSize, FlushReasonTimer, FlushReasonPriority, FlushReasonManual, FlushReasonStop, FlushReasonIdle, FlushReasonDeadline}
+
+func (r FlushReason) index() int {
+	for i, reason := range flushReasons {
+		if reason == r {
+			return i
+		}
+	}
+
+	panic("unexpected flush reason")
+}
+
+// Stats is a snapshot of the activity of a Batch. Sharded batches sum the stats of their shards.
+type Stats struct {
+	// Pending is the number of deduplicated inputs in the current buffer.
+	Pending int
+	// InFlight is the number of callbacks being executed.
+	InFlight int
+	// Flushes is the number of dispatched batches, by reason. Empty buffers are not dispatched.
+	Flushes map[FlushReason]uint64
+	// Inputs is the number of calls to Do().
+	Inputs uint64
+	// DedupHits is the number of inputs merged with a pending input of the same key.
+	DedupHits uint64
+	// Errors is the number of callbacks that returned an error.
+	Errors uint64
+	// LastFlush is the time of the latest dispatch, or zero.
+	LastFlush time.Time
+	// History holds the most recent completed batches, newest first.
+	History []FlushEvent
+}
+
+// FlushEvent describes a completed batch.
+type FlushEvent struct {
+	Shard    int
+	Reason   FlushReason
+	Size     int
+	Time     time.Time // dispatch time
+	Duration time.Duration
+	Err      error
+}
+
+// number of events kept by Stats.History
+const historySize = 32
+
+// merge adds the stats of another shard.
+func (s Stats) merge(other Stats) Stats {
+	flushes := make(map[FlushReason]uint64, len(flushReasons))
+	for _, reason := range flushReasons {
+		flushes[reason] = s.Flushes[reason] + other.Flushes[reason]
+	}
+
+	lastFlush := s.LastFlush
+	if other.LastFlush.After(lastFlush) {
+		lastFlush = other.LastFlush
+	}
+
+	history := append(append([]FlushEvent{}, s.History...), other.History...)
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Time.After(history[j].Time)
+	})
+	if len(history) > historySize {
+		history = history[:historySize]
+	}
+
+	return Stats{
+		Pending:   s.Pending + other.Pending,
+		InFlight:  s.InFlight + other.InFlight,
+		Flushes:   flushes,
+		Inputs:    s.Inputs + other.Inputs,
+		DedupHits: s.DedupHits + other.DedupHits,
+		Errors:    s.Errors + other.Errors,
+		LastFlush: lastFlush,
+		History:   history,
+	}
+}
+
+// counters holds the stats of a batchImpl. 64-bit fields first, for alignment on 32-bit platforms.
+type counters struct {
+	flushes   [len(flushReasons)]uint64 // atomic, indexed by FlushReason.index()
+	errors    uint64                    // atomic
+	lastFlush int64                     // atomic: unix nanoseconds
+	inFlight  int64                     // atomic
+	waiting   int64                     // atomic: number of callers waiting, when a pause limit is set
+
+	mu      sync.Mutex
+	history [historySize]FlushEvent // ring buffer
+	events  int                     // number of recorded events
+
+	// counters of the inputs, one per stripe of the deduplication index, see batchImpl.insert
+	lanes []lane
+}
+
+// lane is padded to a cache line, to prevent false sharing between cores.
+type lane struct {
+	inputs    uint64 // atomic
+	dedupHits uint64 // atomic
+	_         [48]byte
+}
+
+// record appends a completed batch to the history.
+func (c *counters) record(event FlushEvent) {
+	c.mu.Lock()
+	c.history[c.events%historySize] = event
+	c.events++
+	c.mu.Unlock()
+}
+
+func (c *counters) snapshot(pending int) Stats {
+	flushes := make(map[FlushReason]uint64, len(flushReasons))
+	for i, reason := range flushReasons {
+		flushes[reason] = atomic.LoadUint64(&c.flushes[i])
+	}
+
+	var lastFlush time.Time
+	if nano := atomic.LoadInt64(&c.lastFlush); nano != 0 {
+		lastFlush = time.Unix(0, nano)
+	}
+
+	var inputs, dedupHits uint64
+	for i := range c.lanes {
+		inputs += atomic.LoadUint64(&c.lanes[i].inputs)
+		dedupHits += atomic.LoadUint64(&c.lanes[i].dedupHits)
+	}
+
+	return Stats{
+		Pending:   pending,
+		InFlight:  int(atomic.LoadInt64(&c.inFlight)),
+		Flushes:   flushes,
+		Inputs:    inputs,
+		DedupHits: dedupHits,
+		Errors:    atomic.LoadUint64(&c.errors),
+		LastFlush: lastFlush,
+		History:   c.recent(),
+	}
+}
+
+// recent returns the history, newest first.
+func (c *counters) recent() []FlushEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	size := c.events
+	if size > historySize {
+		size = historySize
+	}
+
+	history := make([]FlushEvent, 0, size)
+	for i := 1; i <= size; i++ {
+		history = append(history, c.history[(c.events-i)%historySize])
+	}
+
+	return history
+}
@@ -0,0 +1,116 @@
+package batchify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlushReason_index(t *testing.T) {
+	is := assert.New(t)
+
+	for i, reason := range flushReasons {
+		is.Equal(i, reason.index())
+	}
+
+	is.Panics(func() {
+		FlushReason("unknown").index()
+	})
+}
+
+func TestStats_merge(t *testing.T) {
+	is := assert.New(t)
+
+	now := time.Now()
+
+	a := Stats{
+		Pending:   1,
+		InFlight:  2,
+		Flushes:   map[FlushReason]uint64{FlushReasonSize: 3, FlushReasonTimer: 1},
+		Inputs:    10,
+		DedupHits: 4,
+		Errors:    1,
+		LastFlush: now,
+		History: []FlushEvent{
+			{Shard: 0, Reason: FlushReasonSize, Size: 3, Time: now},
+			{Shard: 0, Reason: FlushReasonSize, Size: 3, Time: now.Add(-2 * time.Second)},
+		},
+	}
+	b := Stats{
+		Pending:   2,
+		InFlight:  0,
+		Flushes:   map[FlushReason]uint64{FlushReasonSize: 1, FlushReasonManual: 2},
+		Inputs:    5,
+		DedupHits: 1,
+		Errors:    0,
+		LastFlush: now.Add(-time.Second),
+		History: []FlushEvent{
+			{Shard: 1, Reason: FlushReasonManual, Size: 1, Time: now.Add(-time.Second), Err: assert.AnError},
+		},
+	}
+
+	is.Equal(
+		Stats{
+			Pending:  3,
+			InFlight: 2,
+			Flushes: map[FlushReason]uint64{
+				FlushReasonSize:     4,
+				FlushReasonTimer:    1,
+				FlushReasonPriority: 0,
+				FlushReasonManual:   2,
+				FlushReasonStop:     0,
+				FlushReasonIdle:     0,
+				FlushReasonDeadline: 0,
+			},
+			Inputs:    15,
+			DedupHits: 5,
+			Errors:    1,
+			LastFlush: now,
+			History: []FlushEvent{
+				{Shard: 0, Reason: FlushReasonSize, Size: 3, Time: now},
+				{Shard: 1, Reason: FlushReasonManual, Size: 1, Time: now.Add(-time.Second), Err: assert.AnError},
+				{Shard: 0, Reason: FlushReasonSize, Size: 3, Time: now.Add(-2 * time.Second)},
+			},
+		},
+		a.merge(b),
+	)
+	is.Equal(now, Stats{}.merge(b).merge(a).LastFlush)
+}
+
+func TestStats_mergeHistorySize(t *testing.T) {
+	is := assert.New(t)
+
+	now := time.Now()
+	history := make([]FlushEvent, historySize)
+	for i := range history {
+		history[i] = FlushEvent{Size: i, Time: now.Add(-time.Duration(i) * time.Second)}
+	}
+
+	merged := Stats{History: history}.merge(Stats{History: history})
+	is.Len(merged.History, historySize)
+	is.Equal(0, merged.History[0].Size)
+	is.Equal(0, merged.History[1].Size)
+	is.Equal(historySize/2-1, merged.History[historySize-1].Size)
+}
+
+func TestCounters_record(t *testing.T) {
+	is := assert.New(t)
+
+	c := &counters{}
+	is.Empty(c.recent())
+
+	c.record(FlushEvent{Size: 1})
+	c.record(FlushEvent{Size: 2})
+	is.Equal([]FlushEvent{{Size: 2}, {Size: 1}}, c.recent())
+
+	for i := 3; i <= historySize+5; i++ {
+		c.record(FlushEvent{Size: i})
+	}
+
+	recent := c.recent()
+	is.Len(recent, historySize)
+	is.Equal(historySize+5, recent[0].Size)
+	is.Equal(6, recent[historySize-1].Size)
+	is.Equal(historySize+5, c.snapshot(0).History[0].Size)
+}
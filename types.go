@@ -1,7 +1,64 @@
 package batchify
 
-type Batch[I comparable, O any] interface {
+import (
+	"context"
+	"time"
+)
+
+type Batch[I any, O any] interface {
 	Do(input I) (output O, err error)
+	DoWithPriority(input I, priority Priority) (output O, err error)
+	DoWithContext(ctx context.Context, input I) (output O, err error)
 	Flush()
+	FlushAndWait(ctx context.Context) error
 	Stop()
+	Pause()
+	Resume()
+	Stats() Stats
+}
+
+// DoFunc is a batch callback. Its context holds the description of the batch. See InfoFromContext.
+type DoFunc[I comparable, O any] func(ctx context.Context, inputs []I) (map[I]O, error)
+
+// Middleware wraps a batch callback, eg: to retry, to time out or to collect metrics.
+// See BatchConfig.WithMiddleware and the pkg/middleware package.
+type Middleware[I comparable, O any] func(next DoFunc[I, O]) DoFunc[I, O]
+
+// KeyedDoFunc is the callback of a batch deduplicating inputs by key. See NewBatchConfigWithKey.
+type KeyedDoFunc[I any, K comparable, O any] func(ctx context.Context, inputs []I) (map[K]O, error)
+
+// KeyedMiddleware wraps the callback of a batch deduplicating inputs by key. See KeyedBatchConfig.WithMiddleware.
+type KeyedMiddleware[I any, K comparable, O any] func(next KeyedDoFunc[I, K, O]) KeyedDoFunc[I, K, O]
+
+// ShardedBatch is implemented by sharded batches. See BatchConfig.WithSharding.
+//
+//	batch := batchify.NewShardedBatch(...).(batchify.ShardedBatch[int, string])
+type ShardedBatch[I any, O any] interface {
+	Batch[I, O]
+	Resize(shards int)
+}
+
+// Settings describes the configuration of a Batch. It is not part of the Batch interface: batches
+// built by this package implement `interface{ Settings() Settings }`.
+type Settings struct {
+	Name           string
+	BufferSize     int
+	TTL            time.Duration
+	LowPriorityTTL time.Duration
+
+	// Shards holds the settings of each shard, or nil for non-sharded batches.
+	// Then, the top-level settings are the settings of the first shard.
+	Shards []Settings
 }
+
+// Priority defines how quickly an input must be dispatched.
+type Priority int
+
+const (
+	// PriorityLow inputs can be held up to the low-priority timer. See BatchConfig.WithLowPriorityTimer.
+	PriorityLow Priority = iota - 1
+	// PriorityNormal inputs are dispatched when the buffer is full or when the timer ends.
+	PriorityNormal
+	// PriorityHigh inputs flush the current buffer right away.
+	PriorityHigh
+)